@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type IntroducedBlob struct {
+	hash     string
+	commitId string
+	path     string
+}
+
+// Lists the blobs each commit adds or changes, a blob only needs to be
+// searched once however many commits it is in, so this is only the
+// commit which first introduced it.
+func GetIntroducedBlobs(ctx context.Context, repository Repository, revisionSliceChunks [][]string) []IntroducedBlob {
+	var blobs []IntroducedBlob
+	seen := make(map[string]int)
+
+	for _, chunk := range revisionSliceChunks {
+		cmdName := "git"
+		cmdArgs := []string{fmt.Sprintf("--git-dir=%s", repository.gitDir), "diff-tree", "--stdin", "-r", "-m", "--root", "--no-renames", "--no-abbrev", "-z"}
+
+		mainLogger.Debug("Running git diff-tree")
+		mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+		cmd := exec.CommandContext(ctx, cmdName, cmdArgs...)
+		cmd.Stdin = strings.NewReader(strings.Join(chunk, "\n") + "\n")
+		cmdOut, err := cmd.Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			mainLogger.Fatal(fmt.Sprintf("There was an error running git diff-tree command: %s", err))
+		}
+
+		// Each commit ID is followed by entries of the form
+		// ":<old mode> <new mode> <old hash> <new hash> <status>" then the path
+		commitId := ""
+		fields := strings.Split(string(cmdOut), "\x00")
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			if !strings.HasPrefix(field, ":") {
+				if len(field) >= 40 {
+					commitId = field[0:40]
+				}
+				continue
+			}
+
+			i++
+			if i >= len(fields) {
+				break
+			}
+			path := fields[i]
+
+			entry := strings.Fields(field)
+			if len(entry) != 5 {
+				continue
+			}
+			mode, hash, status := entry[1], entry[3], entry[4]
+			// Deletions and submodules don't add anything to look at
+			if status == "D" || mode == "160000" || hash == nullHash {
+				continue
+			}
+
+			blob := IntroducedBlob{hash: hash, commitId: commitId, path: path}
+			// Revisions come newest first so later ones replace earlier
+			if pos, found := seen[hash]; found {
+				blobs[pos] = blob
+			} else {
+				seen[hash] = len(blobs)
+				blobs = append(blobs, blob)
+			}
+		}
+	}
+
+	return blobs
+}
+
+// Searches the content of any blobs which have not been searched in a
+// previous run. This replaces git grep when keeping state as grep works
+// on whole commits so would search old blobs again in every new commit.
+func BlobSearch(ctx context.Context, repository Repository, revisionSliceChunks [][]string) {
+	var blobs []IntroducedBlob
+	for _, blob := range GetIntroducedBlobs(ctx, repository, revisionSliceChunks) {
+		if !scanState.HasBlob(blob.hash) {
+			blobs = append(blobs, blob)
+		}
+	}
+
+	if len(blobs) == 0 {
+		return
+	}
+	progress.BlobsAdded(len(blobs))
+
+	cmdName := "git"
+	cmdArgs := []string{fmt.Sprintf("--git-dir=%s", repository.gitDir), "cat-file", "--batch"}
+
+	mainLogger.Debugf("Searching %d blobs", len(blobs))
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	cmd := exec.CommandContext(ctx, cmdName, cmdArgs...)
+	var hashes bytes.Buffer
+	for _, blob := range blobs {
+		hashes.WriteString(blob.hash + "\n")
+	}
+	cmd.Stdin = &hashes
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git cat-file command: %s", err))
+	}
+	if err := cmd.Start(); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git cat-file command: %s", err))
+	}
+
+	// Each blob comes back as "<hash> <type> <size>", the content and
+	// then a new line, or "<hash> missing" if it is not there
+	reader := bufio.NewReader(stdout)
+	for _, blob := range blobs {
+		progress.BlobDone()
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			mainLogger.Fatal(fmt.Sprintf("There was an error reading from git cat-file: %s", err))
+		}
+		headerFields := strings.Fields(header)
+		if len(headerFields) != 3 {
+			mainLogger.Debugf("Blob not available: %s", strings.TrimSpace(header))
+			continue
+		}
+		size, err := strconv.Atoi(headerFields[2])
+		if err != nil {
+			mainLogger.Fatal(fmt.Sprintf("Unexpected output from git cat-file: %s", header))
+		}
+
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			mainLogger.Fatal(fmt.Sprintf("There was an error reading from git cat-file: %s", err))
+		}
+		data = data[:size]
+
+		commit := Commits[blob.commitId]
+		for _, match := range SearchContent(data) {
+			hit := Hit{
+				Type:        GrepMatch,
+				Severity:    match.signature.GetSeverity(),
+				Description: match.signature.GetDescription(),
+				Commit:      &commit,
+				File:        blob.path,
+				Line:        match.line,
+				LineNumber:  match.lineNumber,
+				Context:     match.context,
+			}
+
+			mainLogger.Debugf("Adding BlobSearch result with commit ID %s to channel", commit.id)
+			hitsChannel <- hit
+		}
+
+		scanState.AddBlob(blob.hash)
+	}
+
+	// Killed if the scan was stopped, which isn't worth complaining about
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git cat-file command: %s", err))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Returned when the scan found something so scripts can tell the
+// difference between a clean run and one with findings. 1 is already
+// used by fatal errors and 2 by bad parameters.
+const ExitCodeFindings = 3
+
+// Returned when the scan was stopped early, by Ctrl-C or the timeout,
+// without finding anything, as that isn't the same as a clean run
+const ExitCodeIncomplete = 4
+
+// Returned when the scan was stopped early but had found something, so
+// the findings can't be taken as everything there is
+const ExitCodeIncompleteFindings = 5
+
+// Keeps count of what has been reported, safe to use from any goroutine
+type ResultCollector struct {
+	lock       sync.Mutex
+	typeHits   map[string]int
+	authorHits map[string]map[string]int
+}
+
+var results = NewResultCollector()
+
+func NewResultCollector() *ResultCollector {
+	return &ResultCollector{
+		typeHits:   make(map[string]int),
+		authorHits: make(map[string]map[string]int),
+	}
+}
+
+func (c *ResultCollector) Add(hit Hit) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.typeHits[hit.Type]++
+
+	if author := hit.Author(); author != "" {
+		if c.authorHits[author] == nil {
+			c.authorHits[author] = make(map[string]int)
+		}
+		c.authorHits[author][hit.Type]++
+	}
+}
+
+func (c *ResultCollector) Total() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	total := 0
+	for _, count := range c.typeHits {
+		total += count
+	}
+	return total
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The totals for each type of hit followed by the totals for each author
+func (c *ResultCollector) GetSummaryString() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	output := ""
+	if len(c.typeHits) == 0 {
+		return output
+	}
+
+	output += fmt.Sprintln(au.Bold(au.Cyan("Hits By Type")))
+	for _, hitType := range sortedKeys(c.typeHits) {
+		output += fmt.Sprintf("  %s: %d\n", hitType, c.typeHits[hitType])
+	}
+	output += fmt.Sprintln()
+
+	if len(c.authorHits) == 0 {
+		return output
+	}
+
+	var authors []string
+	for author := range c.authorHits {
+		authors = append(authors, author)
+	}
+	sort.Strings(authors)
+
+	output += fmt.Sprintln(au.Bold(au.Cyan("Hits By Author")))
+	for _, author := range authors {
+		output += fmt.Sprintf("%s\n", author)
+		for _, hitType := range sortedKeys(c.authorHits[author]) {
+			output += fmt.Sprintf("  %s: %d\n", hitType, c.authorHits[author][hitType])
+		}
+	}
+	output += fmt.Sprintln()
+
+	return output
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -10,30 +13,185 @@ import (
 
 type Commit struct {
 	id         string
+	parents    []string
 	author     string
 	authorDate time.Time
 	commit     string
 	commitDate time.Time
 	comment    string
 	matchFiles []core.MatchFile
+	changes    []FileChange
+	// Only worked out for the dump
+	refs      []string
+	submodule string
+}
+
+// A file added, changed or removed by a commit, oldPath is only set for
+// renames and copies. Line counts are only worked out for the dump and
+// are not available for binary files.
+type FileChange struct {
+	path    string
+	oldPath string
+	status  string
+	oldHash string
+	newHash string
+	added   int
+	deleted int
+	binary  bool
+}
+
+// Lines from git log --raw look like
+// ":<old mode> <new mode> <old hash> <new hash> <status>\t<path>"
+// renames and copies have a score after the status and both paths
+func ParseRawLine(line string) (FileChange, bool) {
+	var change FileChange
+
+	parts := strings.Split(line, "\t")
+	fields := strings.Fields(parts[0])
+	if len(fields) != 5 || len(parts) < 2 {
+		return change, false
+	}
+
+	change.oldHash = fields[2]
+	change.newHash = fields[3]
+	change.status = fields[4][0:1]
+	if change.oldHash == nullHash {
+		change.oldHash = ""
+	}
+	if change.newHash == nullHash {
+		change.newHash = ""
+	}
+
+	change.path = unquotePath(parts[1])
+	if (change.status == "R" || change.status == "C") && len(parts) > 2 {
+		change.oldPath = change.path
+		change.path = unquotePath(parts[2])
+	}
+
+	return change, true
+}
+
+func (f *FileChange) SetLineStats(added string, deleted string) {
+	if added == "-" || deleted == "-" {
+		f.binary = true
+		return
+	}
+	f.added, _ = strconv.Atoi(added)
+	f.deleted, _ = strconv.Atoi(deleted)
+}
+
+// Git puts quotes around paths with odd characters in them and escapes
+// them in the same way Go does
+func unquotePath(path string) string {
+	if !strings.HasPrefix(path, `"`) {
+		return path
+	}
+	if unquoted, err := strconv.Unquote(path); err == nil {
+		return unquoted
+	}
+	return path
+}
+
+var changeTypes = map[string]string{
+	"A": "added",
+	"C": "copied",
+	"D": "deleted",
+	"M": "modified",
+	"R": "renamed",
+	"T": "type changed",
+}
+
+func (f *FileChange) ChangeType() string {
+	if changeType, found := changeTypes[f.status]; found {
+		return changeType
+	}
+	return "unknown"
+}
+
+func (f *FileChange) String() string {
+	path := f.path
+	if f.oldPath != "" {
+		path = fmt.Sprintf("%s -> %s", f.oldPath, f.path)
+	}
+
+	if f.binary {
+		return fmt.Sprintf("%s (%s, binary)", path, f.ChangeType())
+	}
+	if lineStats {
+		return fmt.Sprintf("%s (%s, +%d -%d)", path, f.ChangeType(), f.added, f.deleted)
+	}
+	return fmt.Sprintf("%s (%s)", path, f.ChangeType())
+}
+
+// Set from the command line, a commit has to match one of the filters,
+// if there are any, and none of the excludes to be scanned
+var authorFilter, excludeAuthorFilter []*regexp.Regexp
+var committerFilter, excludeCommitterFilter []*regexp.Regexp
+
+func compileFilters(patterns []string) []*regexp.Regexp {
+	var filters []*regexp.Regexp
+	for _, pattern := range patterns {
+		filter, err := regexp.Compile(pattern)
+		if err != nil {
+			mainLogger.Fatalf("Invalid regex %s: %s", pattern, err)
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+func matchesAny(filters []*regexp.Regexp, value string) bool {
+	for _, filter := range filters {
+		if filter.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// The author and commit fields are "Name <email>" so the filters can
+// match either part
+func (c *Commit) Wanted() bool {
+	if len(authorFilter) > 0 && !matchesAny(authorFilter, c.author) {
+		return false
+	}
+	if len(committerFilter) > 0 && !matchesAny(committerFilter, c.commit) {
+		return false
+	}
+	return !matchesAny(excludeAuthorFilter, c.author) && !matchesAny(excludeCommitterFilter, c.commit)
 }
 
 func (c *Commit) PrintCommit() {
-	fmt.Printf(c.GetCommitString())
+	outputDestination.WriteString(c.GetCommitString())
 }
 
 func (c *Commit) GetCommitString() string {
 	output := ""
 
+	if c.submodule != "" {
+		output += fmt.Sprintf("Submodule: %s\n", c.submodule)
+	}
 	output += fmt.Sprintf("Commit ID: %s\n", c.id)
+	if len(c.parents) > 0 {
+		output += fmt.Sprintf("Parents: %s\n", strings.Join(c.parents, ", "))
+	}
+	if len(c.refs) > 0 {
+		output += fmt.Sprintf("Refs: %s\n", strings.Join(c.refs, ", "))
+	}
 	output += fmt.Sprintf("Author: %s\n", c.author)
 	output += fmt.Sprintf("Author Date: %s\n", c.authorDate.String())
 	output += fmt.Sprintf("Commit: %s\n", c.commit)
 	output += fmt.Sprintf("Commit Date: %s\n", c.commitDate.String())
 	output += fmt.Sprintf("Comments: %s\n", c.comment)
 	output += fmt.Sprintln("Files:")
-	for _, f := range c.matchFiles {
-		output += fmt.Sprintf("  * %s\n", f.Path)
+	// Commits from an old state file only have the paths
+	if len(c.changes) == 0 {
+		for _, f := range c.matchFiles {
+			output += fmt.Sprintf("  * %s\n", f.Path)
+		}
+	}
+	for _, f := range c.changes {
+		output += fmt.Sprintf("  * %s\n", f.String())
 	}
 	output += fmt.Sprintln()
 
@@ -57,3 +215,106 @@ func (c *Commit) CommitDate(line string) {
 		mainLogger.Debugf("Error parsing commit date from: %s, err: %s\n", line, err)
 	}
 }
+
+// The fields are not exported so this is how commits get saved along
+// with hits in the state file
+type commitJSON struct {
+	ID         string           `json:"id"`
+	Parents    []string         `json:"parents,omitempty"`
+	Refs       []string         `json:"refs,omitempty"`
+	Author     string           `json:"author"`
+	AuthorDate time.Time        `json:"author_date"`
+	Commit     string           `json:"committer"`
+	CommitDate time.Time        `json:"commit_date"`
+	Comment    string           `json:"comment"`
+	Files      []string         `json:"files"`
+	Changes    []fileChangeJSON `json:"changes,omitempty"`
+	Submodule  string           `json:"submodule,omitempty"`
+}
+
+type fileChangeJSON struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	Change  string `json:"change"`
+	OldBlob string `json:"old_blob,omitempty"`
+	Blob    string `json:"blob,omitempty"`
+	Added   int    `json:"added,omitempty"`
+	Deleted int    `json:"deleted,omitempty"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+func (c Commit) MarshalJSON() ([]byte, error) {
+	files := []string{}
+	for _, f := range c.matchFiles {
+		files = append(files, f.Path)
+	}
+
+	var changes []fileChangeJSON
+	for _, f := range c.changes {
+		changes = append(changes, fileChangeJSON{
+			Path:    f.path,
+			OldPath: f.oldPath,
+			Change:  f.ChangeType(),
+			OldBlob: f.oldHash,
+			Blob:    f.newHash,
+			Added:   f.added,
+			Deleted: f.deleted,
+			Binary:  f.binary,
+		})
+	}
+
+	return json.Marshal(commitJSON{
+		ID:         c.id,
+		Parents:    c.parents,
+		Refs:       c.refs,
+		Author:     c.author,
+		AuthorDate: c.authorDate,
+		Commit:     c.commit,
+		CommitDate: c.commitDate,
+		Comment:    c.comment,
+		Files:      files,
+		Changes:    changes,
+		Submodule:  c.submodule,
+	})
+}
+
+func (c *Commit) UnmarshalJSON(data []byte) error {
+	var j commitJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*c = Commit{
+		id:         j.ID,
+		parents:    j.Parents,
+		refs:       j.Refs,
+		author:     j.Author,
+		authorDate: j.AuthorDate,
+		commit:     j.Commit,
+		commitDate: j.CommitDate,
+		comment:    j.Comment,
+		submodule:  j.Submodule,
+	}
+	for _, f := range j.Files {
+		c.matchFiles = append(c.matchFiles, core.NewMatchFile(f))
+	}
+	for _, f := range j.Changes {
+		change := FileChange{
+			path:    f.Path,
+			oldPath: f.OldPath,
+			oldHash: f.OldBlob,
+			newHash: f.Blob,
+			added:   f.Added,
+			deleted: f.Deleted,
+			binary:  f.Binary,
+		}
+		for status, changeType := range changeTypes {
+			if changeType == f.Change {
+				change.status = status
+			}
+		}
+		c.changes = append(c.changes, change)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+// Git uses the same check to decide whether a file is binary
+const binaryCheckSize = 8000
+
+// Files which have to be read into memory to be searched are skipped if
+// they are bigger than this, they are unlikely to be anything but data
+const maxContentSize = 10 * 1024 * 1024
+
+// Set from the command line, the number of lines to show either side
+// of a content match
+var contextLines int
+
+// A line from around a match
+type ContextLine struct {
+	Number int    `json:"number"`
+	Line   string `json:"line"`
+}
+
+type ContentMatch struct {
+	signature  CommentSignature
+	lineNumber int
+	line       string
+	context    []ContextLine
+}
+
+func IsBinary(data []byte) bool {
+	if len(data) > binaryCheckSize {
+		data = data[:binaryCheckSize]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// Reads a file for SearchContent, or returns nil if it is too big or
+// its first few KB show it is binary, without reading the rest
+func ReadSearchableFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxContentSize {
+		mainLogger.Debugf("Skipping %s as it is %d bytes", path, info.Size())
+		return nil, nil
+	}
+
+	start := make([]byte, binaryCheckSize)
+	count, err := io.ReadFull(file, start)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if IsBinary(start[:count]) {
+		return nil, nil
+	}
+
+	rest, err := io.ReadAll(io.LimitReader(file, maxContentSize))
+	if err != nil {
+		return nil, err
+	}
+	return append(start[:count], rest...), nil
+}
+
+// Runs the comment signatures over each line of some content, used for
+// anything which can't be handed to git grep, such as files which are
+// not in the history.
+func SearchContent(data []byte) []ContentMatch {
+	var matches []ContentMatch
+
+	if IsBinary(data) {
+		return matches
+	}
+
+	lines := SplitLines(data)
+	for pos, line := range lines {
+		for _, signature := range CommentSignatures {
+			if signature.Match(line) {
+				matches = append(matches, ContentMatch{signature, pos + 1, line, GetContext(lines, pos+1)})
+			}
+		}
+	}
+
+	return matches
+}
+
+func SplitLines(data []byte) []string {
+	var lines []string
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	return lines
+}
+
+// The lines either side of the numbered line, which is counted from 1,
+// not including the line itself
+func GetContext(lines []string, lineNumber int) []ContextLine {
+	var context []ContextLine
+
+	if contextLines <= 0 {
+		return context
+	}
+
+	for number := lineNumber - contextLines; number <= lineNumber+contextLines; number++ {
+		if number < 1 || number > len(lines) || number == lineNumber {
+			continue
+		}
+		context = append(context, ContextLine{number, lines[number-1]})
+	}
+
+	return context
+}
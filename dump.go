@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatJSONL    = "jsonl"
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+)
+
+var dumpFormats = []string{FormatText, FormatJSON, FormatCSV, FormatJSONL}
+
+// The dump and the findings each have their own set of formats
+func checkFormat(kind string, format string, formats []string) {
+	for _, known := range formats {
+		if format == known {
+			return
+		}
+	}
+	mainLogger.Fatalf("Unknown %s format, expecting %s: %s", kind, strings.Join(formats, ", "), format)
+}
+
+// Works out which refs each commit can be reached from in a single walk
+// of the whole history, children before parents, passing the refs each
+// commit has on to its parents. The whole history is walked, not just
+// the commits being dumped, so the refs still get through any commits
+// which have been filtered out.
+func LoadCommitRefs(ctx context.Context, repository Repository) {
+	cmdName := "git"
+	// Annotated tags are peeled to get the commit they point at
+	cmdArgs := []string{fmt.Sprintf("--git-dir=%s", repository.gitDir), "for-each-ref", "--format=%(objectname)%09%(*objectname)%09%(refname:short)"}
+
+	mainLogger.Debug("Getting the refs")
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	cmdOut, err := exec.CommandContext(ctx, cmdName, cmdArgs...).Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git for-each-ref command: %s", err))
+	}
+
+	// Refs are kept as their position in the for-each-ref output so they
+	// can be put back in that order
+	var refNames []string
+	commitRefs := make(map[string][]int)
+	for _, line := range strings.Split(strings.TrimSpace(string(cmdOut)), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		target := fields[0]
+		if fields[1] != "" {
+			target = fields[1]
+		}
+		commitRefs[target] = append(commitRefs[target], len(refNames))
+		refNames = append(refNames, fields[2])
+	}
+	if len(refNames) == 0 {
+		return
+	}
+
+	cmdArgs = []string{fmt.Sprintf("--git-dir=%s", repository.gitDir), "rev-list", "--topo-order", "--parents", "--all", "--"}
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	cmd := exec.CommandContext(ctx, cmdName, cmdArgs...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git rev-list command: %s", err))
+	}
+	if err := cmd.Start(); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git rev-list command: %s", err))
+	}
+
+	reader := bufio.NewReader(stdout)
+	for {
+		line, readErr := reader.ReadString('\n')
+		ids := strings.Fields(line)
+		if len(ids) > 0 {
+			// Every child has been seen by now so this commit's refs are
+			// complete and it can be dropped from the map
+			refs := commitRefs[ids[0]]
+			delete(commitRefs, ids[0])
+			for _, parent := range ids[1:] {
+				commitRefs[parent] = mergeRefs(commitRefs[parent], refs)
+			}
+
+			if commit, found := Commits[ids[0]]; found && len(refs) > 0 {
+				commit.refs = nil
+				for _, ref := range refs {
+					commit.refs = append(commit.refs, refNames[ref])
+				}
+				Commits[ids[0]] = commit
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git rev-list command: %s", err))
+	}
+}
+
+// Both lists are sorted so they can be merged without any repeats
+func mergeRefs(a []int, b []int) []int {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+
+	merged := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			merged, a = append(merged, a[0]), a[1:]
+		case a[0] > b[0]:
+			merged, b = append(merged, b[0]), b[1:]
+		default:
+			merged, a, b = append(merged, a[0]), a[1:], b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// Writes the commits out in the given format, the text format is the
+// same as the commit details shown with each hit
+func DumpCommits(commits []Commit, format string) {
+	// Numbered from the oldest, whatever order they are shown in
+	numbers := make(map[string]int)
+	for pos, id := range CommitOrder {
+		numbers[id] = len(CommitOrder) - pos
+	}
+
+	switch format {
+	case FormatText:
+		for _, c := range commits {
+			outputDestination.WriteString(fmt.Sprintf("Commit Number: %d\n", numbers[c.id]))
+			c.PrintCommit()
+		}
+
+	case FormatJSON:
+		if commits == nil {
+			commits = []Commit{}
+		}
+		data, err := json.MarshalIndent(commits, "", "  ")
+		if err != nil {
+			mainLogger.Fatalf("Error converting the commits to JSON: %s", err)
+		}
+		outputDestination.Write(data)
+		outputDestination.WriteString("\n")
+
+	case FormatJSONL:
+		for _, c := range commits {
+			data, err := json.Marshal(c)
+			if err != nil {
+				mainLogger.Fatalf("Error converting the commits to JSON: %s", err)
+			}
+			outputDestination.Write(data)
+			outputDestination.WriteString("\n")
+		}
+
+	case FormatCSV:
+		// One row per commit, the files are joined up in a single column
+		// so the row count matches the commit count
+		writer := csv.NewWriter(outputDestination)
+		writer.Write([]string{"number", "id", "parents", "refs", "author", "author_date", "committer", "commit_date", "submodule", "comment", "files", "added", "deleted"})
+		for _, c := range commits {
+			var files []string
+			added, deleted := 0, 0
+			for _, f := range c.changes {
+				files = append(files, f.String())
+				added += f.added
+				deleted += f.deleted
+			}
+
+			writer.Write(csvSafe([]string{
+				fmt.Sprint(numbers[c.id]),
+				c.id,
+				strings.Join(c.parents, " "),
+				strings.Join(c.refs, " "),
+				c.author,
+				c.authorDate.Format(time.RFC3339),
+				c.commit,
+				c.commitDate.Format(time.RFC3339),
+				c.submodule,
+				c.comment,
+				strings.Join(files, "\n"),
+				fmt.Sprint(added),
+				fmt.Sprint(deleted),
+			}))
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			mainLogger.Fatalf("Error writing the CSV: %s", err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// One line in the manifest for each hit, several hits can point at the
+// same extracted file
+type ManifestEntry struct {
+	File        string `json:"file"`
+	Type        string `json:"type"`
+	Severity    string `json:"severity,omitempty"`
+	Description string `json:"description,omitempty"`
+	Submodule   string `json:"submodule,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	Path        string `json:"path"`
+	Blob        string `json:"blob,omitempty"`
+	Line        string `json:"line,omitempty"`
+}
+
+// Writes the files behind the hits into a directory, committed files go
+// in a directory for the commit they were taken from and uncommitted ones
+// in "uncommitted".
+// Only used from printHits so doesn't need any locking.
+type Extractor struct {
+	dir          string
+	repositories map[string]Repository
+	written      map[string]bool
+	manifest     []ManifestEntry
+}
+
+// Set from the command line
+var extractor *Extractor
+
+func NewExtractor(dir string, repositories []Repository) *Extractor {
+	dir = filepath.Clean(dir)
+	// The files are likely to have secrets in them
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		mainLogger.Fatalf("Error creating the extract directory: %s", err)
+	}
+
+	e := &Extractor{
+		dir:          dir,
+		repositories: make(map[string]Repository),
+		written:      make(map[string]bool),
+	}
+	for _, repository := range repositories {
+		e.repositories[repository.submodule] = repository
+	}
+	return e
+}
+
+func hitField(hit Hit, name string) string {
+	for _, field := range hit.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// File name hits are for the whole life of the file so get its last
+// version, content hits get the file as it was in the commit
+func (e *Extractor) Extract(hit Hit) {
+	if hit.File == "" {
+		return
+	}
+
+	entry := ManifestEntry{
+		Type:        hit.Type,
+		Severity:    hit.Severity,
+		Description: hit.Description,
+		Path:        hit.File,
+		Line:        hit.Line,
+	}
+
+	var err error
+	switch hit.Type {
+	case FileMatch, GrepMatch:
+		submodule := hit.Submodule
+		if hit.Commit != nil {
+			submodule = hit.Commit.submodule
+			entry.Commit = hit.Commit.id
+		}
+		entry.Submodule = submodule
+		entry.File = filepath.Join(submodule, entry.Commit, hit.File)
+
+		// File name hits are for the last version of the file, which goes
+		// under the commit that left it that way, or under its blob if
+		// that commit isn't known
+		entry.Blob = hitField(hit, "Last Blob")
+		revision := entry.Blob
+		if revision == "" {
+			revision = fmt.Sprintf("%s:%s", entry.Commit, hit.File)
+		} else if lastChange := strings.Fields(hitField(hit, "Last Changed In")); len(lastChange) > 0 {
+			entry.Commit = lastChange[0]
+			entry.File = filepath.Join(submodule, entry.Commit, hit.File)
+		} else {
+			entry.Commit = ""
+			entry.File = filepath.Join(submodule, "blobs", entry.Blob, hit.File)
+		}
+		err = e.write(entry.File, false, func(file *os.File) error {
+			return e.catFile(submodule, revision, file)
+		})
+
+	case LFSFileMatch, LFSGrepMatch:
+		// The real content rather than the pointer, if it has been fetched
+		oid := hitField(hit, "LFS Object")
+		if hit.Commit == nil || len(oid) < 4 {
+			return
+		}
+		entry.Submodule = hit.Commit.submodule
+		entry.Commit = hit.Commit.id
+		entry.Blob = oid
+		entry.File = filepath.Join(entry.Submodule, entry.Commit, hit.File)
+
+		pointer := LFSPointer{oid: oid}
+		objectPath := pointer.ObjectPath(e.repositories[entry.Submodule])
+		// Replaces the pointer if the file name hit got there first
+		err = e.write(entry.File, true, func(file *os.File) error {
+			return copyFile(objectPath, file)
+		})
+
+	case UncommittedFileMatch, UncommittedGrepMatch:
+		entry.Submodule = hit.Submodule
+		entry.File = filepath.Join("uncommitted", hit.Submodule, hit.File)
+
+		workTree := e.repositories[hit.Submodule].workTree
+		err = e.write(entry.File, false, func(file *os.File) error {
+			return copyFile(filepath.Join(workTree, hit.File), file)
+		})
+
+	default:
+		return
+	}
+
+	if err != nil {
+		mainLogger.Infof("Could not extract %s: %s", hit.File, err)
+		return
+	}
+	e.manifest = append(e.manifest, entry)
+}
+
+// Each file only gets written once however many hits there are in it,
+// unless it is being replaced with something better
+func (e *Extractor) write(name string, replace bool, content func(*os.File) error) error {
+	if e.written[name] && !replace {
+		return nil
+	}
+
+	target, err := safeJoin(e.dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = content(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	e.written[name] = true
+	return nil
+}
+
+// Not tied to the scan context as whatever was found before a Ctrl-C
+// should still be extracted
+func (e *Extractor) catFile(submodule string, revision string, file *os.File) error {
+	cmdName := "git"
+	cmdArgs := []string{fmt.Sprintf("--git-dir=%s", e.repositories[submodule].gitDir), "cat-file", "blob", revision}
+
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	cmd := exec.Command(cmdName, cmdArgs...)
+	var cmdErr bytes.Buffer
+	cmd.Stdout = file
+	cmd.Stderr = &cmdErr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(cmdErr.String()))
+	}
+	return nil
+}
+
+func copyFile(source string, file *os.File) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	_, err = io.Copy(file, input)
+	return err
+}
+
+// Sorted so the same scan always gives the same manifest
+func (e *Extractor) WriteManifest() error {
+	if e.manifest == nil {
+		e.manifest = []ManifestEntry{}
+	}
+	sort.Slice(e.manifest, func(i, j int) bool {
+		a, b := e.manifest[i], e.manifest[j]
+		for _, pair := range [][2]string{{a.File, b.File}, {a.Type, b.Type}, {a.Description, b.Description}, {a.Line, b.Line}} {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+		}
+		return false
+	})
+	data, err := json.MarshalIndent(e.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(e.dir, "manifest.json"), append(data, '\n'), 0600)
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var hashRegexp = regexp.MustCompile(`\b[0-9a-f]{40}\b`)
+
+// Used in the logs as the old value when a branch is created
+const nullHash = "0000000000000000000000000000000000000000"
+
+var refNameRegexp = regexp.MustCompile(`\brefs/[A-Za-z0-9._/-]+`)
+
+// From the reflog, shows up when switching branches
+var checkoutRegexp = regexp.MustCompile(`checkout: moving from (\S+) to (\S+)`)
+var configSectionRegexp = regexp.MustCompile(`^\s*\[\s*([A-Za-z0-9.-]+)`)
+
+// Files which are fetched before starting on the objects, mostly for the
+// refs and hashes they contain
+var dumpFiles = []string{
+	"HEAD", "ORIG_HEAD", "FETCH_HEAD", "COMMIT_EDITMSG", "description",
+	"config", "packed-refs", "info/refs", "logs/HEAD", "objects/info/packs",
+}
+
+// Refs which are worth asking for even if nothing else mentions them
+var commonRefs = []string{
+	"refs/heads/master", "refs/heads/main", "refs/heads/develop",
+	"refs/remotes/origin/HEAD", "refs/remotes/origin/master", "refs/remotes/origin/main",
+	"refs/stash",
+}
+
+// Only these config sections are kept, anything else, such as core or
+// filter, could get git to run commands when the repository is scanned
+var safeConfigSections = []string{"remote", "branch", "credential", "http", "user", "url", "submodule"}
+
+type gitDumper struct {
+	ctx     context.Context
+	baseURL string
+	gitDir  string
+	client  *http.Client
+
+	packed     map[string]bool
+	seen       map[string]bool
+	parents    map[string][]string
+	trees      map[string]string
+	subtrees   map[string][]string
+	downloaded int
+	missing    int
+}
+
+// Downloads as much as possible of an exposed .git directory into a
+// scratch directory so it can be scanned like any other repository.
+// As with PrepareRepository, the function returned tidies up, and if the
+// scan is stopped before the download finishes there is nothing to scan
+// so the repository returned is empty.
+func DumpGitDirectory(ctx context.Context, url string) (Repository, func()) {
+	scratchDir, err := os.MkdirTemp("", "githunter-")
+	if err != nil {
+		mainLogger.Fatalf("Error creating scratch directory: %s", err)
+	}
+	cleanup := func() {
+		mainLogger.Debugf("Removing scratch directory: %s", scratchDir)
+		os.RemoveAll(scratchDir)
+	}
+
+	baseURL := strings.TrimSuffix(url, "/")
+	if !strings.HasSuffix(baseURL, ".git") {
+		baseURL = baseURL + "/.git"
+	}
+
+	dumper := gitDumper{
+		ctx:      ctx,
+		baseURL:  baseURL + "/",
+		gitDir:   filepath.Join(scratchDir, "repository.git"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		packed:   make(map[string]bool),
+		seen:     make(map[string]bool),
+		parents:  make(map[string][]string),
+		trees:    make(map[string]string),
+		subtrees: make(map[string][]string),
+	}
+
+	if err := dumper.dump(); err != nil {
+		if ctx.Err() != nil {
+			return Repository{}, cleanup
+		}
+		cleanup()
+		safeURL, _, _ := redactURL(url)
+		mainLogger.Fatalf("Error downloading the Git directory from %s: %s", safeURL, err)
+	}
+
+	return Repository{gitDir: dumper.gitDir}, cleanup
+}
+
+func (d *gitDumper) fetch(name string) ([]byte, error) {
+	url := d.baseURL + name
+	mainLogger.Debugf("Fetching %s", url)
+
+	request, err := http.NewRequestWithContext(d.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, response.Status)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// Names come from the server so could try to climb out of the directory
+func (d *gitDumper) write(name string, data []byte) error {
+	target, err := safeJoin(d.gitDir, filepath.FromSlash(name))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0644)
+}
+
+func (d *gitDumper) dump() error {
+	head, err := d.fetch("HEAD")
+	if err != nil {
+		return fmt.Errorf("could not get HEAD, is the directory exposed? %s", err)
+	}
+	if !bytes.HasPrefix(head, []byte("ref: ")) && !hashRegexp.Match(head) {
+		return fmt.Errorf("HEAD does not look like it came from a Git repository")
+	}
+
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(d.gitDir, dir), 0755); err != nil {
+			return err
+		}
+	}
+
+	var hashes []string
+	refs := make(map[string]bool)
+	for _, ref := range commonRefs {
+		refs[ref] = true
+	}
+
+	for _, name := range dumpFiles {
+		data, err := d.fetch(name)
+		if err != nil {
+			mainLogger.Debugf("Not available: %s", err)
+			continue
+		}
+
+		switch name {
+		case "config":
+			data = sanitiseConfig(data, true)
+		case "objects/info/packs":
+			d.fetchPacks(data)
+			continue
+		}
+
+		// Anything which is not text is a server making things up
+		if IsBinary(data) {
+			continue
+		}
+
+		if err := d.write(name, data); err != nil {
+			return err
+		}
+
+		hashes = append(hashes, hashRegexp.FindAllString(string(data), -1)...)
+		for _, ref := range refNameRegexp.FindAllString(string(data), -1) {
+			refs[ref] = true
+		}
+		for _, matchBits := range checkoutRegexp.FindAllStringSubmatch(string(data), -1) {
+			refs["refs/heads/"+matchBits[1]] = true
+			refs["refs/heads/"+matchBits[2]] = true
+		}
+	}
+
+	// Any branch mentioned in the logs should have a ref and its own log
+	for ref := range refs {
+		for _, name := range []string{ref, "logs/" + ref} {
+			data, err := d.fetch(name)
+			if err != nil || !hashRegexp.Match(data) || IsBinary(data) {
+				continue
+			}
+			if err := d.write(name, data); err != nil {
+				return err
+			}
+			hashes = append(hashes, hashRegexp.FindAllString(string(data), -1)...)
+		}
+	}
+
+	// Walk everything reachable from the hashes found so far
+	queue := hashes
+	for len(queue) > 0 {
+		// Every fetch would fail anyway once the scan has been stopped
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+		hash := queue[0]
+		queue = queue[1:]
+		if d.seen[hash] || hash == nullHash {
+			continue
+		}
+		d.seen[hash] = true
+		queue = append(queue, d.fetchObject(hash)...)
+	}
+
+	// Hashes from the logs and the likes of ORIG_HEAD may not be on any
+	// branch, giving them refs means they get scanned with everything else
+	for _, hash := range hashes {
+		if _, isCommit := d.parents[hash]; isCommit || d.packed[hash] {
+			d.write("refs/recovered/"+hash, []byte(hash+"\n"))
+		}
+	}
+
+	d.removeBrokenRefs()
+
+	mainLogger.Infof("Downloaded %d objects and %d packs, %d objects could not be found", d.downloaded, len(d.packFiles()), d.missing)
+
+	return nil
+}
+
+// Keeps the interesting parts of the config and drops anything which
+// could change how git behaves when it is run against the repository
+func sanitiseConfig(data []byte, bare bool) []byte {
+	output := fmt.Sprintf("[core]\n\trepositoryformatversion = 0\n\tbare = %t\n", bare)
+
+	keep := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if matchBits := configSectionRegexp.FindStringSubmatch(line); matchBits != nil {
+			keep = false
+			for _, section := range safeConfigSections {
+				if strings.EqualFold(matchBits[1], section) {
+					keep = true
+				}
+			}
+		}
+		if keep {
+			output += line + "\n"
+		}
+	}
+
+	return []byte(output)
+}
+
+func (d *gitDumper) packFiles() []string {
+	packs, _ := filepath.Glob(filepath.Join(d.gitDir, "objects", "pack", "*.pack"))
+	return packs
+}
+
+// Downloads the packs listed in objects/info/packs and records which
+// objects they contain so they are not asked for individually
+func (d *gitDumper) fetchPacks(list []byte) {
+	packRegexp := regexp.MustCompile(`(?m)^P (pack-[0-9a-f]{40})\.pack$`)
+
+	for _, matchBits := range packRegexp.FindAllSubmatch(list, -1) {
+		name := "objects/pack/" + string(matchBits[1])
+
+		index, err := d.fetch(name + ".idx")
+		if err != nil {
+			mainLogger.Debugf("Not available: %s", err)
+			continue
+		}
+		pack, err := d.fetch(name + ".pack")
+		if err != nil {
+			mainLogger.Debugf("Not available: %s", err)
+			continue
+		}
+
+		hashes, err := parsePackIndex(index)
+		if err != nil {
+			mainLogger.Debugf("Could not parse %s.idx: %s", name, err)
+			continue
+		}
+
+		if d.write(name+".idx", index) != nil || d.write(name+".pack", pack) != nil {
+			continue
+		}
+
+		for _, hash := range hashes {
+			d.packed[hash] = true
+		}
+	}
+}
+
+// Version 2 pack indexes, the only ones written by any recent git, are
+// a header, a 256 entry fan out table and then the sorted object names
+func parsePackIndex(index []byte) ([]string, error) {
+	header := []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}
+	if len(index) < 8+256*4 || !bytes.Equal(index[0:8], header) {
+		return nil, fmt.Errorf("not a version 2 pack index")
+	}
+
+	count := int(binary.BigEndian.Uint32(index[8+255*4 : 8+256*4]))
+	start := 8 + 256*4
+	if len(index) < start+count*20 {
+		return nil, fmt.Errorf("pack index is truncated")
+	}
+
+	var hashes []string
+	for i := 0; i < count; i++ {
+		hashes = append(hashes, hex.EncodeToString(index[start+i*20:start+(i+1)*20]))
+	}
+
+	return hashes, nil
+}
+
+// Fetches a loose object and returns the hashes of any objects it
+// refers to. Objects in packs are assumed to have everything they
+// refer to in the pack as well, which is how git builds them.
+func (d *gitDumper) fetchObject(hash string) []string {
+	if d.packed[hash] {
+		return nil
+	}
+
+	name := fmt.Sprintf("objects/%s/%s", hash[0:2], hash[2:])
+	compressed, err := d.fetch(name)
+	if err != nil {
+		mainLogger.Debugf("Missing object: %s", err)
+		d.missing++
+		return nil
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		mainLogger.Debugf("Object %s is not compressed: %s", hash, err)
+		d.missing++
+		return nil
+	}
+	raw, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		mainLogger.Debugf("Object %s could not be decompressed: %s", hash, err)
+		d.missing++
+		return nil
+	}
+
+	// Makes sure the server sent what was asked for
+	sum := sha1.Sum(raw)
+	if hex.EncodeToString(sum[:]) != hash {
+		mainLogger.Debugf("Object %s does not match its hash", hash)
+		d.missing++
+		return nil
+	}
+
+	if err := d.write(name, compressed); err != nil {
+		mainLogger.Debugf("Could not write object %s: %s", hash, err)
+		return nil
+	}
+	d.downloaded++
+
+	// The header is "<type> <size>" followed by a NUL
+	nul := bytes.IndexByte(raw, 0)
+	if nul == -1 {
+		return nil
+	}
+	objectType, _, _ := strings.Cut(string(raw[:nul]), " ")
+	body := raw[nul+1:]
+
+	switch objectType {
+	case "commit":
+		hashes := parseCommitObject(body)
+		// The tree comes first, everything after it is a parent
+		if len(hashes) > 0 {
+			d.trees[hash] = hashes[0]
+			d.parents[hash] = hashes[1:]
+		}
+		return hashes
+	case "tag":
+		return parseCommitObject(body)
+	case "tree":
+		hashes, subtrees := parseTreeObject(body)
+		d.subtrees[hash] = subtrees
+		return hashes
+	}
+
+	return nil
+}
+
+// Commits and tags have a header of "key value" lines, the tree, parents
+// and tagged object are the ones which point at other objects
+func parseCommitObject(body []byte) []string {
+	var hashes []string
+
+	header, _, _ := bytes.Cut(body, []byte("\n\n"))
+	for _, line := range strings.Split(string(header), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "tree", "parent", "object":
+			hashes = append(hashes, value)
+		}
+	}
+
+	return hashes
+}
+
+// Tree entries are "<mode> <name>" followed by a NUL and the 20 byte hash,
+// the trees in it are returned separately as well as with everything else
+func parseTreeObject(body []byte) ([]string, []string) {
+	var hashes []string
+	var subtrees []string
+
+	for len(body) > 0 {
+		nul := bytes.IndexByte(body, 0)
+		if nul == -1 || len(body) < nul+21 {
+			break
+		}
+		mode, _, _ := strings.Cut(string(body[:nul]), " ")
+		hash := hex.EncodeToString(body[nul+1 : nul+21])
+		body = body[nul+21:]
+
+		// Submodules point at commits in a different repository
+		if mode == "160000" {
+			continue
+		}
+		if mode == "40000" {
+			subtrees = append(subtrees, hash)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, subtrees
+}
+
+func (d *gitDumper) hasObject(hash string) bool {
+	if d.packed[hash] {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(d.gitDir, "objects", hash[0:2], hash[2:]))
+	return err == nil
+}
+
+// Git can't list the files in a commit unless it has every tree under
+// the commit's own one, blobs don't matter as only their hashes are needed
+func (d *gitDumper) hasTree(hash string, checked map[string]bool) bool {
+	if d.packed[hash] {
+		return true
+	}
+	if complete, found := checked[hash]; found {
+		return complete
+	}
+
+	subtrees, complete := d.subtrees[hash]
+	for _, subtree := range subtrees {
+		if !complete {
+			break
+		}
+		complete = d.hasTree(subtree, checked)
+	}
+	checked[hash] = complete
+
+	return complete
+}
+
+// Git refuses to work with refs which point at missing commits and
+// commits with missing parents, and stops altogether at commits with
+// missing trees, so these are all treated as missing. The refs to them
+// are dropped, the commits after them are marked as shallow so git
+// treats them as the start of the history, and the commits before them
+// are given refs so they still get scanned.
+func (d *gitDumper) removeBrokenRefs() {
+	checked := make(map[string]bool)
+	broken := func(hash string) bool {
+		if !d.hasObject(hash) {
+			return true
+		}
+		tree, isLoose := d.trees[hash]
+		return isLoose && !d.hasTree(tree, checked)
+	}
+
+	for hash, parents := range d.parents {
+		if !broken(hash) {
+			continue
+		}
+		mainLogger.Debugf("Skipping commit with missing trees: %s", hash)
+		for _, parent := range parents {
+			if !broken(parent) {
+				d.write("refs/recovered/"+parent, []byte(parent+"\n"))
+			}
+		}
+	}
+
+	filepath.WalkDir(filepath.Join(d.gitDir, "refs"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		hash := hashRegexp.FindString(string(data))
+		if hash != "" && broken(hash) {
+			mainLogger.Debugf("Removing ref to missing object: %s", path)
+			os.Remove(path)
+		}
+		return nil
+	})
+
+	var packedRefs []string
+	if data, err := os.ReadFile(filepath.Join(d.gitDir, "packed-refs")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			hash := hashRegexp.FindString(line)
+			if hash == "" || !broken(hash) {
+				packedRefs = append(packedRefs, line)
+			}
+		}
+		d.write("packed-refs", []byte(strings.Join(packedRefs, "\n")))
+	}
+
+	shallow := ""
+	for hash, parents := range d.parents {
+		if broken(hash) {
+			continue
+		}
+		for _, parent := range parents {
+			if broken(parent) {
+				shallow += hash + "\n"
+				break
+			}
+		}
+	}
+	if shallow != "" {
+		d.write("shallow", []byte(shallow))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// A repository with three commits, each adding a file in its own
+// directory so there are trees under the top level ones. Every commit
+// changes all the files so no two commits share a tree.
+func makeServedRepository(t *testing.T) (string, []string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet", "--initial-branch=master")
+
+	var commits []string
+	names := []string{"one", "two", "three"}
+	for pos, name := range names {
+		for _, directory := range names[:pos+1] {
+			if err := os.MkdirAll(filepath.Join(dir, directory), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, directory, "file.txt"), []byte(name+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "--quiet", "-m", name)
+		commits = append(commits, runGit(t, dir, "rev-parse", "HEAD"))
+	}
+	runGit(t, dir, "update-server-info")
+
+	return dir, commits
+}
+
+func dumpedCommits(t *testing.T, dir string) []string {
+	t.Helper()
+
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	repository, cleanup := DumpGitDirectory(context.Background(), server.URL)
+	defer cleanup()
+
+	log := runGit(t, dir, "--git-dir="+repository.gitDir, "log", "--all", "--name-status", "--format=%H")
+	return hashRegexp.FindAllString(log, -1)
+}
+
+func TestDumpGitDirectory(t *testing.T) {
+	dir, commits := makeServedRepository(t)
+
+	// The commits are all made in the same second so their order is not fixed
+	got := dumpedCommits(t, dir)
+	want := append([]string{}, commits...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got commits %v, want %v", got, want)
+	}
+}
+
+func TestDumpGitDirectoryMissingTree(t *testing.T) {
+	dir, commits := makeServedRepository(t)
+
+	// The directory added in the middle commit
+	tree := runGit(t, dir, "rev-parse", commits[1]+":two")
+	if err := os.Remove(filepath.Join(dir, ".git", "objects", tree[0:2], tree[2:])); err != nil {
+		t.Fatal(err)
+	}
+
+	got := dumpedCommits(t, dir)
+	want := map[string]bool{commits[0]: true, commits[2]: true}
+	if len(got) != len(want) {
+		t.Fatalf("got commits %v, want %s and %s", got, commits[2], commits[0])
+	}
+	for _, commit := range got {
+		if !want[commit] {
+			t.Errorf("commit %s should not have been reachable", commit)
+		}
+	}
+}
+
+func TestParsePackIndex(t *testing.T) {
+	hashes := []string{
+		"0123456789abcdef0123456789abcdef01234567",
+		"89abcdef0123456789abcdef0123456789abcdef",
+		"fedcba9876543210fedcba9876543210fedcba98",
+	}
+
+	index := []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}
+	fanOut := make([]byte, 256*4)
+	for bucket := 0; bucket < 256; bucket++ {
+		count := 0
+		for _, hash := range hashes {
+			first, _ := hex.DecodeString(hash[0:2])
+			if int(first[0]) <= bucket {
+				count++
+			}
+		}
+		binary.BigEndian.PutUint32(fanOut[bucket*4:], uint32(count))
+	}
+	index = append(index, fanOut...)
+	for _, hash := range hashes {
+		raw, _ := hex.DecodeString(hash)
+		index = append(index, raw...)
+	}
+
+	got, err := parsePackIndex(index)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(got, " ") != strings.Join(hashes, " ") {
+		t.Errorf("got %v, want %v", got, hashes)
+	}
+
+	if _, err := parsePackIndex(index[:len(index)-1]); err == nil {
+		t.Error("expected an error for a truncated index")
+	}
+
+	version1 := append([]byte{}, index...)
+	copy(version1, bytes.Repeat([]byte{0}, 8))
+	if _, err := parsePackIndex(version1); err == nil {
+		t.Error("expected an error for an index without the version 2 header")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	core "github.com/digininja/GitHunter/gitrob"
+)
+
+// Everything that happened to a file with an interesting name, under
+// all the names it has had, so it can be reported once rather than for
+// every commit which touched it
+type FileHistory struct {
+	submodule string
+	signature core.Signature
+	names     []string
+	matchedAs string
+
+	added    Commit
+	deleted  *Commit
+	present  map[string]bool
+	lastPath string
+	lastBlob string
+	// The commit which left the file with the last blob
+	lastChange *Commit
+	hasNew     bool
+	changedIn  int
+}
+
+// A file is gone once none of its names are left
+func (f *FileHistory) apply(commit Commit, change FileChange) {
+	if f.changedIn == 0 {
+		f.added = commit
+	}
+	f.changedIn++
+
+	if change.oldPath != "" && change.status == "R" {
+		f.present[change.oldPath] = false
+	}
+	if change.status == "D" {
+		f.present[change.path] = false
+		f.lastBlob = change.oldHash
+	} else {
+		f.present[change.path] = true
+		f.lastBlob = change.newHash
+		f.lastChange = &commit
+	}
+	f.lastPath = change.path
+
+	f.deleted = nil
+	for _, present := range f.present {
+		if present {
+			return
+		}
+	}
+	f.deleted = &commit
+}
+
+// The names come from the repository and the command is going to be
+// pasted into a shell, so a file called "x;rm -rf ~" has to stay a name
+func shellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
+
+func (f *FileHistory) Hit() Hit {
+	hit := Hit{
+		Type:        FileMatch,
+		Description: f.signature.Description(),
+		Comment:     f.signature.Comment(),
+		Commit:      &f.added,
+		File:        f.lastPath,
+	}
+	if len(f.names) > 1 {
+		hit.AddField("Path History", PathHistoryString(f.names))
+	}
+	if f.matchedAs != f.lastPath {
+		hit.AddField("Matched As", f.matchedAs)
+	}
+	hit.AddField("Added In", fmt.Sprintf("%s (%s)", f.added.id, f.added.commitDate.String()))
+	if f.deleted != nil {
+		hit.AddField("Deleted In", fmt.Sprintf("%s (%s)", f.deleted.id, f.deleted.commitDate.String()))
+	} else {
+		hit.AddField("Deleted In", "still present")
+	}
+
+	if f.lastBlob != "" {
+		hit.AddField("Last Blob", f.lastBlob)
+		if f.lastChange != nil {
+			hit.AddField("Last Changed In", fmt.Sprintf("%s (%s)", f.lastChange.id, f.lastChange.commitDate.String()))
+		}
+
+		command := "git"
+		if f.submodule != "" {
+			command = fmt.Sprintf("git -C %s", shellQuote(f.submodule))
+		}
+		hit.AddField("Recover With", fmt.Sprintf("%s cat-file -p %s > %s", command, f.lastBlob, shellQuote(path.Base(f.lastPath))))
+	}
+
+	return hit
+}
+
+// Goes through the history oldest first building up what happened to
+// each file whose name, or any of its old names, matches a signature.
+// Commits already scanned in a previous run are included so the added
+// and deleted commits are right but only files which have been touched
+// by one of the new commits are reported.
+func FilenameSearch(newCommits []Commit) {
+	isNew := make(map[string]bool)
+	for _, commit := range newCommits {
+		isNew[commit.id] = true
+	}
+
+	type lineageMatch struct {
+		signature core.Signature
+		name      string
+	}
+	lineageMatches := make(map[string][]lineageMatch)
+
+	histories := make(map[string]*FileHistory)
+	var order []string
+
+	for pos := len(CommitOrder) - 1; pos >= 0; pos-- {
+		commit := Commits[CommitOrder[pos]]
+
+		for _, change := range commit.changes {
+			names := GetPathLineage(commit.submodule, change.path)
+			lineageKey := commit.submodule + "\x00" + names[0]
+
+			matches, found := lineageMatches[lineageKey]
+			if !found {
+				for _, signature := range core.Signatures {
+					for _, name := range names {
+						if signature.Match(core.NewMatchFile(name)) {
+							matches = append(matches, lineageMatch{signature, name})
+							break
+						}
+					}
+				}
+				lineageMatches[lineageKey] = matches
+			}
+
+			for pos, match := range matches {
+				key := fmt.Sprintf("%s\x00%d", lineageKey, pos)
+				history := histories[key]
+				if history == nil {
+					history = &FileHistory{
+						submodule: commit.submodule,
+						signature: match.signature,
+						names:     names,
+						matchedAs: match.name,
+						present:   make(map[string]bool),
+					}
+					histories[key] = history
+					order = append(order, key)
+				}
+				history.apply(commit, change)
+				if isNew[commit.id] {
+					history.hasNew = true
+				}
+			}
+		}
+	}
+
+	for _, key := range order {
+		history := histories[key]
+		if !history.hasNew {
+			continue
+		}
+
+		hit := history.Hit()
+		mainLogger.Debugf("Adding FilenameSearch result for %s to channel", history.lastPath)
+		hitsChannel <- hit
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+)
+
+const (
+	FileMatch            = "File Match"
+	CommitMatch          = "Commit Match"
+	GrepMatch            = "Grep Match"
+	MetadataMatch        = "Metadata Match"
+	UncommittedFileMatch = "File Match (uncommitted)"
+	UncommittedGrepMatch = "Grep Match (uncommitted)"
+	LFSFileMatch         = "LFS File Match"
+	LFSGrepMatch         = "LFS Grep Match"
+)
+
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+// Higher is worse, used to sort by severity
+var severityRanks = map[string]int{SeverityHigh: 3, SeverityMedium: 2, SeverityLow: 1}
+
+// Used unless the pattern which found the hit says otherwise. Credentials
+// in the .git directory are usually still live, commit messages are only
+// ever a pointer to something else.
+func defaultSeverity(hitType string) string {
+	switch hitType {
+	case MetadataMatch:
+		return SeverityHigh
+	case CommitMatch:
+		return SeverityLow
+	default:
+		return SeverityMedium
+	}
+}
+
+// Extra details which only make sense for some types of hit, such as
+// the state of an uncommitted file, kept in the order they are shown
+type HitField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Hit struct {
+	Type        string `json:"type"`
+	Severity    string `json:"severity,omitempty"`
+	Description string `json:"description,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+	// Only set for hits which are not tied to a commit, those
+	// which are take it from the commit
+	Submodule  string        `json:"submodule,omitempty"`
+	Commit     *Commit       `json:"commit,omitempty"`
+	File       string        `json:"file,omitempty"`
+	Line       string        `json:"line,omitempty"`
+	LineNumber int           `json:"line_number,omitempty"`
+	Context    []ContextLine `json:"context,omitempty"`
+	Fields     []HitField    `json:"fields,omitempty"`
+}
+
+func (h *Hit) AddField(name string, value string) {
+	h.Fields = append(h.Fields, HitField{name, value})
+}
+
+// The .git directory and the working tree are searched in full every
+// run so only hits from the history are worth keeping between runs
+func (h *Hit) InHistory() bool {
+	switch h.Type {
+	case MetadataMatch, UncommittedFileMatch, UncommittedGrepMatch:
+		return false
+	default:
+		return true
+	}
+}
+
+func (h *Hit) Author() string {
+	if h.Commit == nil {
+		return ""
+	}
+	return h.Commit.author
+}
+
+// Identifies a hit so the same thing found twice is only reported once.
+// A file name hit covers the whole life of the file and its details
+// change as the history grows, so it is only identified by the file,
+// through its first name, and the signature which matched it.
+func (h *Hit) Key() string {
+	commitId := ""
+	submodule := h.Submodule
+	if h.Commit != nil {
+		commitId = h.Commit.id
+		submodule = h.Commit.submodule
+	}
+
+	if h.Type == FileMatch {
+		firstName := h.File
+		if names := hitField(*h, "Path History"); names != "" {
+			firstName = strings.Split(names, PathHistorySeparator)[0]
+		}
+		return strings.Join([]string{h.Type, h.Description, submodule, firstName}, "\x00")
+	}
+
+	key := []string{h.Type, h.Description, h.Submodule, commitId, h.File, h.Line}
+	for _, field := range h.Fields {
+		key = append(key, field.Name, field.Value)
+	}
+	return strings.Join(key, "\x00")
+}
+
+func (h *Hit) colour(arg interface{}) aurora.Value {
+	switch h.Type {
+	case CommitMatch:
+		return au.Red(arg)
+	case GrepMatch, UncommittedGrepMatch, LFSGrepMatch:
+		return au.Green(arg)
+	case MetadataMatch:
+		return au.Magenta(arg)
+	default:
+		return au.Blue(arg)
+	}
+}
+
+// The text shown for the hit, content matches have the file and line
+// after the commit details so they stand out
+func (h *Hit) GetHitString() string {
+	output := ""
+	output += fmt.Sprintln(au.Bold(h.colour(h.Type)))
+	if h.Severity != "" {
+		output += fmt.Sprintf("Severity: %s\n", h.Severity)
+	}
+	if h.Description != "" {
+		output += fmt.Sprintf("Description: %s\n", h.Description)
+	}
+	if h.Comment != "" {
+		output += fmt.Sprintf("Comment: %s\n", h.Comment)
+	}
+	if h.Commit == nil && h.Submodule != "" {
+		output += fmt.Sprintf("Submodule: %s\n", h.Submodule)
+	}
+	if h.Line == "" && h.File != "" {
+		output += fmt.Sprintf("Hit on file: %s\n", h.File)
+	}
+	for _, field := range h.Fields {
+		output += fmt.Sprintf("%s: %s\n", field.Name, field.Value)
+	}
+	if h.Commit != nil {
+		output += h.Commit.GetCommitString()
+	}
+	if h.Line != "" {
+		if h.File != "" {
+			output += fmt.Sprintf("Match In File: %s\n", h.File)
+		}
+		if h.LineNumber > 0 {
+			output += fmt.Sprintf("Line Number: %d\n", h.LineNumber)
+		}
+		output += fmt.Sprintf("Matching Line: %s\n", h.Line)
+		output += h.contextString()
+		output += fmt.Sprintln()
+	} else if h.Commit == nil {
+		output += fmt.Sprintln()
+	}
+
+	return output
+}
+
+// The surrounding lines with the matching line marked, in file order
+func (h *Hit) contextString() string {
+	if len(h.Context) == 0 {
+		return ""
+	}
+
+	output := fmt.Sprintln("Context:")
+	shownMatch := false
+	for _, line := range h.Context {
+		if !shownMatch && line.Number > h.LineNumber {
+			output += fmt.Sprintf("> %6d  %s\n", h.LineNumber, h.Line)
+			shownMatch = true
+		}
+		output += fmt.Sprintf("  %6d  %s\n", line.Number, line.Line)
+	}
+	if !shownMatch {
+		output += fmt.Sprintf("> %6d  %s\n", h.LineNumber, h.Line)
+	}
+
+	return output
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"sort"
+)
+
+// A bar in one of the summary charts
+type chartBar struct {
+	Label   string
+	Class   string
+	Count   int
+	Percent int
+}
+
+type htmlReport struct {
+	ReportDetails
+	Total      int
+	Severities []chartBar
+	Types      []chartBar
+	Hits       []ReportHit
+}
+
+// Bars are sized against the biggest so the charts always fill the space
+func chartBars(counts map[string]int, order []string) []chartBar {
+	largest := 0
+	for _, count := range counts {
+		if count > largest {
+			largest = count
+		}
+	}
+
+	var bars []chartBar
+	for _, label := range order {
+		if counts[label] == 0 {
+			continue
+		}
+		bars = append(bars, chartBar{
+			Label:   label,
+			Count:   counts[label],
+			Percent: counts[label] * 100 / largest,
+		})
+	}
+	return bars
+}
+
+// A single file with everything it needs inside it, so it can be sent
+// on as it is and opened without a network connection
+func WriteHTMLReport(w io.Writer, hits []ReportHit, details ReportDetails) error {
+	severities := make(map[string]int)
+	types := make(map[string]int)
+	for _, hit := range hits {
+		severities[hit.Severity]++
+		types[hit.Type]++
+	}
+
+	var typeOrder []string
+	for hitType := range types {
+		typeOrder = append(typeOrder, hitType)
+	}
+	sort.Strings(typeOrder)
+
+	report := htmlReport{
+		ReportDetails: details,
+		Total:         len(hits),
+		Severities:    chartBars(severities, []string{SeverityHigh, SeverityMedium, SeverityLow}),
+		Types:         chartBars(types, typeOrder),
+		Hits:          hits,
+	}
+	// Coloured to match the severity labels
+	for pos := range report.Severities {
+		report.Severities[pos].Class = report.Severities[pos].Label
+	}
+
+	return htmlReportTemplate.Execute(w, report)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>GitHunter Report - {{.Repository}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #222; background: #f4f5f7; }
+header { background: #1d2833; color: #fff; padding: 1em 2em; }
+header h1 { margin: 0 0 0.2em 0; font-size: 1.6em; }
+header p { margin: 0.2em 0; color: #c8d0d8; }
+main { padding: 1em 2em; }
+.incomplete { background: #fff3cd; border: 1px solid #e0c060; padding: 0.6em 1em; margin-bottom: 1em; }
+.charts { display: flex; flex-wrap: wrap; gap: 1em; margin-bottom: 1em; }
+.chart { background: #fff; border: 1px solid #d8dde3; padding: 0.8em 1em; flex: 1 1 20em; }
+.chart h2 { font-size: 1.1em; margin: 0 0 0.6em 0; }
+.bar { display: flex; align-items: center; margin: 0.3em 0; font-size: 0.9em; }
+.bar .label { width: 12em; flex: none; }
+.bar .track { flex: 1; background: #eef0f3; margin-right: 0.6em; }
+.bar .fill { height: 1.1em; background: #5b7a99; }
+.bar .fill.high { background: #c0392b; }
+.bar .fill.medium { background: #e08e0b; }
+.bar .fill.low { background: #2e86c1; }
+.controls { display: flex; flex-wrap: wrap; gap: 1em; align-items: center; margin-bottom: 1em; }
+.controls input { flex: 1 1 20em; padding: 0.4em; font-size: 1em; }
+.group > h2 { font-size: 1.1em; margin: 1.2em 0 0.4em 0; }
+.group > h2 .count { color: #777; font-weight: normal; }
+details.hit { background: #fff; border: 1px solid #d8dde3; margin: 0.3em 0; }
+details.hit > summary { padding: 0.5em 0.8em; cursor: pointer; }
+details.hit > .body { padding: 0 1em 0.8em 1em; }
+.severity { display: inline-block; min-width: 4.5em; text-align: center; color: #fff; border-radius: 3px; font-size: 0.8em; padding: 0.1em 0.3em; background: #5b7a99; }
+.severity.high { background: #c0392b; }
+.severity.medium { background: #e08e0b; }
+.severity.low { background: #2e86c1; }
+.where { color: #555; font-family: monospace; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th { text-align: left; vertical-align: top; padding: 0.15em 1em 0.15em 0; white-space: nowrap; color: #555; font-weight: normal; }
+td { padding: 0.15em 0; word-break: break-all; }
+pre { background: #f7f7f9; border: 1px solid #e1e4e8; padding: 0.5em; overflow-x: auto; margin: 0.3em 0; }
+pre .marked { background: #fde2e1; }
+.empty { color: #777; }
+</style>
+</head>
+<body>
+<header>
+<h1>GitHunter Report</h1>
+<p>Repository: {{.Repository}}</p>
+<p>Generated: {{.Generated.Format "2006-01-02 15:04:05 MST"}}</p>
+<p>Findings: {{.Total}}</p>
+</header>
+<main>
+{{if .Incomplete}}<div class="incomplete">The scan stopped early as {{.Incomplete}}, these findings only cover part of the repository.</div>
+{{end}}
+{{if .Hits}}
+<div class="charts">
+<div class="chart">
+<h2>By Severity</h2>
+{{range .Severities}}<div class="bar"><span class="label">{{.Label}}</span><span class="track"><div class="fill {{.Class}}" style="width: {{.Percent}}%"></div></span><span>{{.Count}}</span></div>
+{{end}}</div>
+<div class="chart">
+<h2>By Type</h2>
+{{range .Types}}<div class="bar"><span class="label">{{.Label}}</span><span class="track"><div class="fill {{.Class}}" style="width: {{.Percent}}%"></div></span><span>{{.Count}}</span></div>
+{{end}}</div>
+</div>
+
+<div class="controls">
+<input id="search" type="search" placeholder="Search the findings">
+<label>Group by
+<select id="group">
+<option value="type">Type</option>
+<option value="severity">Severity</option>
+<option value="file">File</option>
+</select>
+</label>
+<span id="shown"></span>
+</div>
+
+<div id="hits">
+{{range .Hits}}<details class="hit" data-type="{{.Type}}" data-severity="{{.Severity}}" data-file="{{if .Submodule}}{{.Submodule}}/{{end}}{{.Path}}">
+<summary><span class="severity {{.Severity}}">{{.Severity}}</span> <strong>{{.Type}}</strong>{{if .Rule}} - {{.Rule}}{{end}}{{if .Path}} <span class="where">{{.Path}}{{if .LineNumber}}:{{.LineNumber}}{{end}}</span>{{end}}</summary>
+<div class="body">
+<table>
+{{if .Comment}}<tr><th>Comment</th><td>{{.Comment}}</td></tr>
+{{end}}{{if .Submodule}}<tr><th>Submodule</th><td>{{.Submodule}}</td></tr>
+{{end}}{{if .Path}}<tr><th>File</th><td>{{.Path}}</td></tr>
+{{end}}{{range .Fields}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}{{if .CommitID}}<tr><th>Commit</th><td>{{.CommitID}}</td></tr>
+<tr><th>Author</th><td>{{.Author}}</td></tr>
+<tr><th>Committer</th><td>{{.Committer}}</td></tr>
+<tr><th>Date</th><td>{{.Date.Format "2006-01-02 15:04:05 -0700"}}</td></tr>
+{{if .Refs}}<tr><th>Refs</th><td>{{range $pos, $ref := .Refs}}{{if $pos}}, {{end}}{{$ref}}{{end}}</td></tr>
+{{end}}<tr><th>Message</th><td>{{.Message}}</td></tr>
+{{end}}</table>
+{{if .Match}}<pre>{{if .LineNumber}}{{.LineNumber}}: {{end}}{{.Match}}</pre>
+{{end}}{{if .Context}}{{$number := .LineNumber}}<details>
+<summary>Context</summary>
+<pre>{{range .ContextWithMatch}}<span{{if eq .Number $number}} class="marked"{{end}}>{{printf "%6d" .Number}}  {{.Line}}</span>
+{{end}}</pre>
+</details>
+{{end}}</div>
+</details>
+{{end}}</div>
+{{else}}
+<p class="empty">No interesting information found.</p>
+{{end}}
+</main>
+<script>
+(function () {
+	var container = document.getElementById("hits");
+	if (!container) {
+		return;
+	}
+	var hits = Array.prototype.slice.call(container.querySelectorAll("details.hit"));
+	var search = document.getElementById("search");
+	var group = document.getElementById("group");
+	var shown = document.getElementById("shown");
+	var severityOrder = { high: 0, medium: 1, low: 2 };
+
+	function regroup() {
+		var key = group.value;
+		var groups = {};
+		var names = [];
+		hits.forEach(function (hit) {
+			var name = hit.getAttribute("data-" + key) || "(none)";
+			if (!groups[name]) {
+				groups[name] = [];
+				names.push(name);
+			}
+			groups[name].push(hit);
+		});
+		names.sort(function (a, b) {
+			if (key === "severity") {
+				return (a in severityOrder ? severityOrder[a] : 9) - (b in severityOrder ? severityOrder[b] : 9);
+			}
+			return a < b ? -1 : a > b ? 1 : 0;
+		});
+
+		container.innerHTML = "";
+		names.forEach(function (name) {
+			var section = document.createElement("section");
+			section.className = "group";
+			var heading = document.createElement("h2");
+			heading.appendChild(document.createTextNode(name + " "));
+			var count = document.createElement("span");
+			count.className = "count";
+			heading.appendChild(count);
+			section.appendChild(heading);
+			groups[name].forEach(function (hit) {
+				section.appendChild(hit);
+			});
+			container.appendChild(section);
+		});
+		filter();
+	}
+
+	function filter() {
+		var terms = search.value.toLowerCase().split(/\s+/).filter(function (term) {
+			return term !== "";
+		});
+		var total = 0;
+		Array.prototype.forEach.call(container.querySelectorAll("section.group"), function (section) {
+			var visible = 0;
+			Array.prototype.forEach.call(section.querySelectorAll("details.hit"), function (hit) {
+				var text = hit.textContent.toLowerCase();
+				var match = terms.every(function (term) {
+					return text.indexOf(term) !== -1;
+				});
+				hit.style.display = match ? "" : "none";
+				if (match) {
+					visible++;
+				}
+			});
+			section.style.display = visible ? "" : "none";
+			section.querySelector(".count").textContent = "(" + visible + ")";
+			total += visible;
+		});
+		shown.textContent = "Showing " + total + " of " + hits.length;
+	}
+
+	search.addEventListener("input", filter);
+	group.addEventListener("change", regroup);
+	regroup();
+})();
+</script>
+</body>
+</html>
+`))
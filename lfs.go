@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	core "github.com/digininja/GitHunter/gitrob"
+)
+
+const lfsVersionPattern = "^version https://git-lfs.github.com/spec/v1$"
+const lfsOIDPattern = "^oid sha256:[0-9a-f]{64}$"
+
+// Same format as the normal grep output, rev:path:line
+var lfsGrepOutputRegexp = regexp.MustCompile("^(?P<ID>[a-f0-9]*):(?P<File>.*):oid sha256:(?P<OID>[0-9a-f]{64})$")
+
+type LFSPointer struct {
+	commitId string
+	path     string
+	oid      string
+}
+
+// Set in .gitattributes for the files LFS looks after
+var lfsFilterRegexp = regexp.MustCompile(`\bfilter=lfs\b`)
+
+// A repository is worth checking for pointers if it has a local object
+// store or if any version of a .gitattributes file has marked files as
+// tracked by LFS. Plenty of repositories have a .gitattributes for other
+// reasons so the content has to be checked.
+func UsesLFS(ctx context.Context, repository Repository) bool {
+	if _, err := os.Stat(filepath.Join(repository.gitDir, "lfs")); err == nil {
+		return true
+	}
+
+	checked := make(map[string]bool)
+	for _, id := range CommitOrder {
+		commit := Commits[id]
+		if commit.submodule != repository.submodule {
+			continue
+		}
+		for _, change := range commit.changes {
+			if path.Base(change.path) != ".gitattributes" || change.status == "D" || checked[change.newHash] {
+				continue
+			}
+			checked[change.newHash] = true
+
+			for _, line := range GetBlobLines(ctx, repository.gitDir, change.newHash) {
+				if lfsFilterRegexp.MatchString(line) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// The local copy of the object, if it has been fetched
+func (p *LFSPointer) ObjectPath(repository Repository) string {
+	return filepath.Join(repository.gitDir, "lfs", "objects", p.oid[0:2], p.oid[2:4], p.oid)
+}
+
+// Uses git grep to find all the pointer files in the given revisions.
+// A pointer will be in every commit after it was added so only the
+// earliest commit it appears in is kept.
+func FindLFSPointers(ctx context.Context, repository Repository, revisionSliceChunks [][]string) []LFSPointer {
+	var pointers []LFSPointer
+	seen := make(map[string]int)
+
+	for _, chunk := range revisionSliceChunks {
+		cmdName := "git"
+		cmdArgs := []string{fmt.Sprintf("--git-dir=%s", repository.gitDir), "grep", "-I", "--all-match", "-E", "-e", lfsVersionPattern, "-e", lfsOIDPattern}
+		cmdArgs = append(cmdArgs, chunk...)
+
+		mainLogger.Debug("Running a git grep for LFS pointers")
+		mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+		// As with the normal grep, 1 means nothing found
+		cmdOut, err := exec.CommandContext(ctx, cmdName, cmdArgs...).Output()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err.Error() != "exit status 1" {
+				mainLogger.Fatal(fmt.Sprintf("There was an error running git grep command: %s", err))
+			}
+			continue
+		}
+
+		for _, line := range strings.Split(strings.TrimSpace(string(cmdOut)), "\n") {
+			matchBits := lfsGrepOutputRegexp.FindStringSubmatch(line)
+			if len(matchBits) != 4 {
+				continue
+			}
+
+			pointer := LFSPointer{commitId: matchBits[1], path: matchBits[2], oid: matchBits[3]}
+			key := pointer.path + ":" + pointer.oid
+
+			// Revisions come newest first so later ones replace earlier
+			if pos, found := seen[key]; found {
+				pointers[pos] = pointer
+			} else {
+				seen[key] = len(pointers)
+				pointers = append(pointers, pointer)
+			}
+		}
+	}
+
+	return pointers
+}
+
+// Reports pointers with interesting file names, whether or not the
+// object is available, and if doing content checks, searches the
+// real content of any objects which are.
+func LFSSearch(ctx context.Context, repository Repository, revisionSliceChunks [][]string, doGrep bool) {
+	for _, pointer := range FindLFSPointers(ctx, repository, revisionSliceChunks) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		commit := Commits[pointer.commitId]
+		objectPath := pointer.ObjectPath(repository)
+
+		// Objects can be huge so are only read if they are to be searched
+		objectState := fmt.Sprintf("available at %s", objectPath)
+		_, err := os.Stat(objectPath)
+		if err != nil {
+			mainLogger.Debugf("LFS object %s not available: %s", pointer.oid, err)
+			objectState = "not in the local store"
+		}
+
+		matchFile := core.NewMatchFile(pointer.path)
+		for _, signature := range core.Signatures {
+			if signature.Match(matchFile) {
+				hit := Hit{
+					Type:        LFSFileMatch,
+					Description: signature.Description(),
+					Comment:     signature.Comment(),
+					Commit:      &commit,
+					File:        pointer.path,
+				}
+				hit.AddField("LFS Object", pointer.oid)
+				hit.AddField("Object State", objectState)
+
+				mainLogger.Debugf("Adding LFSSearch file result with commit ID %s to channel", commit.id)
+				hitsChannel <- hit
+			}
+		}
+
+		if !doGrep || err != nil {
+			continue
+		}
+
+		data, err := ReadSearchableFile(objectPath)
+		if err != nil {
+			mainLogger.Debugf("Could not read LFS object %s: %s", pointer.oid, err)
+			continue
+		}
+
+		for _, match := range SearchContent(data) {
+			hit := Hit{
+				Type:        LFSGrepMatch,
+				Severity:    match.signature.GetSeverity(),
+				Description: match.signature.GetDescription(),
+				Commit:      &commit,
+				File:        pointer.path,
+				Line:        match.line,
+				LineNumber:  match.lineNumber,
+				Context:     match.context,
+			}
+			hit.AddField("LFS Object", pointer.oid)
+
+			mainLogger.Debugf("Adding LFSSearch content result with commit ID %s to channel", commit.id)
+			hitsChannel <- hit
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// All the names a file has had, linked up through the renames and copies
+// in the history. Built once all the commits have been read and only
+// read after that so it is safe to use from any goroutine.
+type PathLineage struct {
+	parent    map[string]string
+	firstSeen map[string]time.Time
+	names     map[string][]string
+}
+
+// One for each submodule as they have their own paths, the top level
+// repository is ""
+var pathLineages = make(map[string]*PathLineage)
+
+func (l *PathLineage) find(path string) string {
+	for l.parent[path] != path {
+		// Halving the path as it goes keeps the lookups short
+		l.parent[path] = l.parent[l.parent[path]]
+		path = l.parent[path]
+	}
+	return path
+}
+
+func (l *PathLineage) seen(path string, date time.Time) {
+	if first, found := l.firstSeen[path]; !found || date.Before(first) {
+		l.firstSeen[path] = date
+	}
+}
+
+func (l *PathLineage) join(a string, b string) {
+	for _, path := range []string{a, b} {
+		if _, found := l.parent[path]; !found {
+			l.parent[path] = path
+		}
+	}
+	rootA, rootB := l.find(a), l.find(b)
+	if rootA != rootB {
+		l.parent[rootB] = rootA
+	}
+}
+
+func BuildPathLineages() {
+	for _, id := range CommitOrder {
+		commit := Commits[id]
+		lineage := pathLineages[commit.submodule]
+		if lineage == nil {
+			lineage = &PathLineage{
+				parent:    make(map[string]string),
+				firstSeen: make(map[string]time.Time),
+				names:     make(map[string][]string),
+			}
+			pathLineages[commit.submodule] = lineage
+		}
+
+		for _, change := range commit.changes {
+			lineage.seen(change.path, commit.commitDate)
+			if change.oldPath == "" {
+				continue
+			}
+			// In case the commit which added it wasn't scanned, the old
+			// name still has to come before the new one
+			lineage.seen(change.oldPath, commit.commitDate.Add(-time.Nanosecond))
+			lineage.join(change.oldPath, change.path)
+		}
+	}
+
+	// The names in the order they first appeared, every path gets the
+	// same list as the others it is linked to
+	for _, lineage := range pathLineages {
+		groups := make(map[string][]string)
+		for path := range lineage.parent {
+			root := lineage.find(path)
+			groups[root] = append(groups[root], path)
+		}
+		for _, names := range groups {
+			sort.Slice(names, func(i, j int) bool {
+				a, b := lineage.firstSeen[names[i]], lineage.firstSeen[names[j]]
+				if !a.Equal(b) {
+					return a.Before(b)
+				}
+				return names[i] < names[j]
+			})
+			for _, path := range names {
+				lineage.names[path] = names
+			}
+		}
+	}
+}
+
+// Every name the file has been known by, oldest first, or just the path
+// if it has never been renamed or copied
+func GetPathLineage(submodule string, path string) []string {
+	if lineage := pathLineages[submodule]; lineage != nil {
+		if names, found := lineage.names[path]; found {
+			return names
+		}
+	}
+	return []string{path}
+}
+
+const PathHistorySeparator = " -> "
+
+func PathHistoryString(names []string) string {
+	return strings.Join(names, PathHistorySeparator)
+}
@@ -2,14 +2,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 
 	"os"
 	"os/exec"
+	"os/signal"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
 
 	core "github.com/digininja/GitHunter/gitrob"
 
@@ -50,19 +58,79 @@ var Usage = func() {
 }
 
 var mainLogger = logrus.New()
-var SomethingFound = false
 var Commits map[string]Commit
+
+// The IDs from Commits in the order git log gave them, newest first
+var CommitOrder []string
+
+// Commits have to start with this, a file name can start with "commit".
+// The commit ID is followed by the IDs of its parents.
+var commitLineRegexp = regexp.MustCompile("^commit [0-9a-f]{40}")
+
+// Anything else after the commit ID, such as decorations, is not a parent
+var commitIDRegexp = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// The added and deleted line counts, - for binary files, then the path
+var numstatLineRegexp = regexp.MustCompile(`^(\d+|-)\t(\d+|-)\t`)
+
+// Working out line stats means diffing every file so is only done for
+// the dump, the scans only need the paths
+var lineStats bool
 var outputDestination *os.File
 
+// Limits on which commits are scanned, passed to both git log and rev-list
+var revisionFilter []string
+
+// The branches, refs and ranges to scan in the top level repository
+var revisionSelection []string
+
+// For parameters which can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func main() {
-	gitDirPtr := CommandLine.String("gitdir", ".", "Directory containing the repository")
+	gitDirPtr := CommandLine.String("gitdir", ".", "Directory containing the repository, or a bundle, tar, tar.gz or zip file of one")
 	patternsFilePtr := CommandLine.String("patterns", "patterns.json", "File containing patterns to match")
 	dumpPtr := CommandLine.Bool("dump", false, "Dump the commit details")
+	formatPtr := CommandLine.String("format", FormatText, "Format for the findings: text, html, markdown, csv, json or jsonl, or for the dump: text, json, csv or jsonl")
 	nocoloursPtr := CommandLine.Bool("nocolours", false, "Set this to disable coloured output")
 	helpPtr := CommandLine.Bool("help", false, "Show usage information")
 	doGrepPtr := CommandLine.Bool("grep", false, "Grep files for content")
+	clonePtr := CommandLine.String("clone", "", "URL or path of a repository to mirror clone and scan")
+	urlPtr := CommandLine.String("url", "", "URL of an exposed .git directory to download and scan")
+	extractPtr := CommandLine.String("extract", "", "Directory to write the files behind any file name or content hits to, along with a manifest")
+	redactPtr := CommandLine.Bool("redact", false, "Mask secrets in the output, keeping a little of each end and a hash to match them up")
+	redactFilePtr := CommandLine.String("redact-file", "", "File to write the unmasked values to, along with their hashes, when redacting")
+	statePtr := CommandLine.String("state", "", "File to keep track of what has been scanned so later runs only scan new commits and blobs")
+	workersPtr := CommandLine.Int("workers", runtime.NumCPU(), "Number of scans to run at the same time")
+	timeoutPtr := CommandLine.Duration("timeout", 0, "Stop the scan after this long, e.g. 30m, and report what has been found so far")
+	contextPtr := CommandLine.Int("context", 0, "Number of lines to show either side of content matches")
+	sortPtr := CommandLine.String("sort", SortDate, "Order for the findings and the dump: date, author, severity, file, or none to show findings as they are found")
+	progressPtr := CommandLine.String("progress", ProgressAuto, "Show progress on stderr: auto, on, off or json for status events")
+	worktreePtr := CommandLine.Bool("worktree", false, "Also search uncommitted, untracked and ignored files in the working directory")
 	debugPtr := CommandLine.String("debugLevel", "", "Debug options, I = Info, D = Full Debug")
 	outputToPtr := CommandLine.String("output", "-", "File to write output to, - for standard out")
+	sincePtr := CommandLine.String("since", "", "Only scan commits more recent than this date, anything git log accepts")
+	untilPtr := CommandLine.String("until", "", "Only scan commits older than this date, anything git log accepts")
+	var outputs stringList
+	CommandLine.Var(&outputs, "out", "Also write the findings as format:path, e.g. html:report.html, can be given more than once")
+	var branches, refs, ranges stringList
+	var authors, excludeAuthors, committers, excludeCommitters stringList
+	CommandLine.Var(&authors, "author", "Only scan commits with an author name or email matching this regex, can be given more than once")
+	CommandLine.Var(&excludeAuthors, "exclude-author", "Skip commits with an author name or email matching this regex, can be given more than once")
+	CommandLine.Var(&committers, "committer", "Only scan commits with a committer name or email matching this regex, can be given more than once")
+	CommandLine.Var(&excludeCommitters, "exclude-committer", "Skip commits with a committer name or email matching this regex, can be given more than once")
+	CommandLine.Var(&branches, "branch", "Only scan this branch, can be given more than once")
+	CommandLine.Var(&refs, "ref", "Only scan this ref, tag or commit, can be given more than once")
+	CommandLine.Var(&ranges, "range", "Only scan this commit range, e.g. v1.0..main, can be given more than once")
 
 	CommandLine.Usage = Usage
 	CommandLine.Parse(os.Args[1:])
@@ -74,6 +142,40 @@ func main() {
 
 	doGrep := *doGrepPtr
 
+	contextLines = *contextPtr
+	sortOrder = *sortPtr
+	checkSortOrder(sortOrder)
+	if *dumpPtr {
+		checkFormat("dump", *formatPtr, dumpFormats)
+		if len(outputs) > 0 {
+			mainLogger.Fatalf("The -out option is only for the findings, use -output for the dump")
+		}
+	} else {
+		checkFormat("findings", *formatPtr, findingsFormats)
+	}
+
+	if *sincePtr != "" {
+		revisionFilter = append(revisionFilter, fmt.Sprintf("--since=%s", *sincePtr))
+	}
+	if *untilPtr != "" {
+		revisionFilter = append(revisionFilter, fmt.Sprintf("--until=%s", *untilPtr))
+	}
+	for _, branch := range branches {
+		revisionSelection = append(revisionSelection, fmt.Sprintf("refs/heads/%s", branch))
+	}
+	revisionSelection = append(revisionSelection, refs...)
+	authorFilter = compileFilters(authors)
+	excludeAuthorFilter = compileFilters(excludeAuthors)
+	committerFilter = compileFilters(committers)
+	excludeCommitterFilter = compileFilters(excludeCommitters)
+
+	for _, commitRange := range ranges {
+		if !strings.Contains(commitRange, "..") {
+			mainLogger.Fatalf("The range should be in the form A..B: %s", commitRange)
+		}
+		revisionSelection = append(revisionSelection, commitRange)
+	}
+
 	switch strings.ToUpper(*debugPtr) {
 	case "I":
 		mainLogger.SetLevel(logrus.InfoLevel)
@@ -95,28 +197,65 @@ func main() {
 
 	defer outputDestination.Close()
 
-	fmt.Println(Banner)
+	// Keeps anything other than text clean when written to standard out
+	bannerDestination := os.Stdout
+	if *formatPtr != FormatText {
+		bannerDestination = os.Stderr
+	}
+	fmt.Fprintln(bannerDestination, Banner)
 	if *outputToPtr != "-" {
-		fmt.Printf("Writing output to: %s\n", *outputToPtr)
+		fmt.Fprintf(bannerDestination, "Writing output to: %s\n", *outputToPtr)
 	}
 
-	gitDir := ""
-	if *gitDirPtr != "" {
-		gitDir = *gitDirPtr
-		if gitDir[len(gitDir)-1:] != "/" {
-			gitDir = gitDir + "/"
-		}
-		gitDir = fmt.Sprintf("%s.git", gitDir)
-		mainLogger.Debugf("Checking to see if Git directory exists: %s", gitDir)
-		// A few options here, this is why I went with this one:
-		// https://goruncode.com/how-to-check-if-a-file-exists/
-		if _, err := os.Stat(gitDir); err != nil {
-			mainLogger.Fatalf("The specified directory does not exist or does not contain a Git repository")
+	// -output and -format are the first sink, -out adds any others
+	if !*dumpPtr {
+		outputSinks = append(outputSinks, NewOutputSink(*formatPtr, outputDestination, true))
+		for _, output := range outputs {
+			sink, format, path := ParseOutputSink(output)
+			outputSinks = append(outputSinks, sink)
+			if path != "-" {
+				fmt.Fprintf(bannerDestination, "Writing %s output to: %s\n", format, path)
+			}
 		}
-	} else {
+	}
+
+	if *gitDirPtr == "" {
 		Usage()
+		os.Exit(-1)
 	}
 
+	// Ctrl-C or the timeout stop anything new being started, whatever
+	// has been found by then is still reported
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *timeoutPtr > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeoutPtr)
+		defer cancel()
+	}
+	go func() {
+		<-ctx.Done()
+		// A second Ctrl-C kills it straight away
+		stop()
+		mainLogger.Infof("Stopping the scan as %s, press Ctrl-C again to quit without waiting", stopReason(ctx))
+	}()
+
+	var repository Repository
+	var cleanup func()
+	// What the reports say was scanned
+	target := *gitDirPtr
+	if *clonePtr != "" {
+		target, _, _ = redactURL(*clonePtr)
+		fmt.Fprintf(bannerDestination, "Cloning: %s\n", target)
+		repository, cleanup = CloneRepository(ctx, *clonePtr)
+	} else if *urlPtr != "" {
+		target, _, _ = redactURL(*urlPtr)
+		repository, cleanup = DumpGitDirectory(ctx, *urlPtr)
+	} else {
+		repository, cleanup = PrepareRepository(ctx, *gitDirPtr)
+	}
+	defer cleanup()
+
 	patternsFile := *patternsFilePtr
 	mainLogger.Debugf("Checking to see if patterns file exists: %s", patternsFile)
 
@@ -128,48 +267,290 @@ func main() {
 
 	au = aurora.NewAurora(!*nocoloursPtr)
 
-	var (
-		cmdOut []byte
-		err    error
-	)
+	// Nothing to scan if the scan was stopped before the repository could
+	// be got, it is still reported as an incomplete scan
+	var repositories []Repository
+	if repository.gitDir != "" {
+		repositories = append(repositories, repository)
+		repositories = append(repositories, FindSubmodules(ctx, repository)...)
+	}
+
+	if *statePtr != "" && !*dumpPtr {
+		scanState = LoadState(*statePtr)
+	}
+	if *redactFilePtr != "" && !*redactPtr {
+		mainLogger.Fatalf("The -redact-file option needs -redact")
+	}
+	if *redactPtr {
+		redactor = NewRedactor(*redactFilePtr)
+		defer redactor.Close()
+	}
+	if *extractPtr != "" && !*dumpPtr {
+		extractor = NewExtractor(*extractPtr, repositories)
+	}
+
+	Commits = make(map[string]Commit)
+
+	if *dumpPtr {
+		lineStats = true
+		for _, repository := range repositories {
+			LoadCommits(ctx, repository, nil)
+			LoadCommitRefs(ctx, repository)
+		}
+
+		if ctx.Err() != nil {
+			message := fmt.Sprintf("Dump incomplete as %s, only the commits read before then are shown", stopReason(ctx))
+			if *formatPtr == FormatText {
+				outputDestination.WriteString(message + "\n")
+			} else {
+				mainLogger.Warn(message)
+			}
+		}
+
+		commits := SortedCommits(sortOrder)
+		if redactor != nil {
+			for pos := range commits {
+				commits[pos].comment = redactor.Text(commits[pos].comment, false)
+			}
+		}
+		DumpCommits(commits, *formatPtr)
+	} else {
+		// Anything found last time is reported along with anything new
+		var previousFindings []Hit
+		if scanState != nil {
+			previousFindings = scanState.Findings
+			scanState.Findings = nil
+		}
+
+		done := make(chan bool)
+		go printHits(previousFindings, done)
+
+		progress.Start(*progressPtr)
+		pool := NewWorkerPool(ctx, *workersPtr)
+
+		for _, repository := range repositories {
+			repository := repository
+
+			// The files in the .git directory itself
+			pool.Submit(func() { MetadataSearch(repository) })
+
+			if *worktreePtr && repository.workTree != "" {
+				pool.Submit(func() { WorktreeSearch(ctx, repository) })
+			}
+		}
+
+		// The message checks start as soon as each commit has been read,
+		// the rest need all the commits first
+		var newCommits []Commit
+		for _, repository := range repositories {
+			LoadCommits(ctx, repository, func(commit Commit) {
+				if scanState.HasCommit(commit.id) {
+					return
+				}
+				newCommits = append(newCommits, commit)
+
+				// Check the commit messages
+				pool.Submit(func() {
+					for _, signature := range CommentSignatures {
+						CommitMessageSearch(commit, signature)
+					}
+				})
+			})
+		}
+
+		// Then check filenames, under every name each file has had
+		BuildPathLineages()
+		pool.Submit(func() { FilenameSearch(newCommits) })
+
+		for _, repository := range repositories {
+			repository := repository
+			usesLFS := UsesLFS(ctx, repository)
+			if !doGrep && !usesLFS {
+				continue
+			}
+
+			revisionSliceChunks := GetRevisionChunks(ctx, repository)
+
+			// Now checking for file contents
+			if doGrep && scanState != nil {
+				pool.Submit(func() { BlobSearch(ctx, repository, revisionSliceChunks) })
+			} else if doGrep {
+				progress.ChunksAdded(len(CommentSignatures) * len(revisionSliceChunks))
+				for _, signature := range CommentSignatures {
+					for _, chunk := range revisionSliceChunks {
+						signature, chunk := signature, chunk
+						pool.Submit(func() { GrepSearch(ctx, signature, chunk, repository.gitDir) })
+					}
+				}
+			}
+
+			// Pointer files hide the real content from the grep
+			if usesLFS {
+				pool.Submit(func() { LFSSearch(ctx, repository, revisionSliceChunks, doGrep) })
+			}
+		}
+
+		pool.Wait()
+		close(hitsChannel)
+		<-done
+		progress.Stop()
+		incomplete := ctx.Err() != nil
+
+		if scanState != nil {
+			// Blobs are only recorded once they have been searched but
+			// the commits may not have been, so leave them for next time
+			if !incomplete {
+				for id := range Commits {
+					scanState.AddCommit(id)
+				}
+			}
+			if err := scanState.Save(*statePtr); err != nil {
+				mainLogger.Fatalf("Error saving the state file: %s", err)
+			}
+		}
+
+		details := ReportDetails{Repository: target, Generated: time.Now()}
+		if incomplete {
+			details.Incomplete = stopReason(ctx)
+			// The text output says so itself
+			if *formatPtr != FormatText {
+				mainLogger.Warnf("Scan incomplete as %s, these results only cover part of the repository", details.Incomplete)
+			}
+		}
+		for _, sink := range outputSinks {
+			if err := sink.Finish(details); err != nil {
+				mainLogger.Errorf("Error writing the findings: %s", err)
+			}
+			if err := sink.Close(); err != nil {
+				mainLogger.Errorf("Error closing the output: %s", err)
+			}
+		}
+
+		exitCode := 0
+		switch {
+		case incomplete && results.Total() > 0:
+			exitCode = ExitCodeIncompleteFindings
+		case incomplete:
+			exitCode = ExitCodeIncomplete
+		case results.Total() > 0:
+			exitCode = ExitCodeFindings
+		}
+
+		if exitCode != 0 {
+			// Deferred calls don't run on exit
+			cleanup()
+			os.Exit(exitCode)
+		}
+	}
+}
+
+func stopReason(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "the timeout was reached"
+	}
+	return "it was interrupted"
+}
+
+// The arguments to pick the commits to scan. Branch names and the like
+// only mean something in the top level repository so submodules always
+// have all their commits scanned, subject to the date limits.
+func RevisionArgs(repository Repository) []string {
+	args := append([]string{}, revisionFilter...)
+	if repository.submodule == "" && len(revisionSelection) > 0 {
+		args = append(args, revisionSelection...)
+	} else {
+		args = append(args, "--all")
+	}
+
+	// Stops git trying to treat anything as a path
+	return append(args, "--")
+}
+
+// Parses the log for a repository as git produces it, adding each of its
+// commits to Commits and handing them to found, if set, as soon as they
+// have been read so they can be scanned while the rest of the log is
+// still coming in.
+func LoadCommits(ctx context.Context, repository Repository, found func(Commit)) {
 	cmdName := "git"
-	cmdArgs := []string{"log", "--pretty=fuller", "--name-only", "--all"}
-	if gitDir != "" {
-		cmdArgs = append([]string{fmt.Sprintf("--git-dir=%s", gitDir)}, cmdArgs...)
+	// -M and -C pick up renames and copies so files can be followed,
+	// --no-decorate stops log.decorate in the user's config adding ref
+	// names to the commit line
+	cmdArgs := []string{"log", "--pretty=fuller", "--no-decorate", "--parents", "--raw", "--no-abbrev", "-M", "-C", "--date-order"}
+	if lineStats {
+		cmdArgs = append(cmdArgs, "--numstat")
+	}
+	cmdArgs = append(cmdArgs, RevisionArgs(repository)...)
+	if repository.gitDir != "" {
+		cmdArgs = append([]string{fmt.Sprintf("--git-dir=%s", repository.gitDir)}, cmdArgs...)
 	}
 
 	mainLogger.Debug("Getting all commit messages and files")
 	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
 
-	if cmdOut, err = exec.Command(cmdName, cmdArgs...).Output(); err != nil {
+	cmd := exec.CommandContext(ctx, cmdName, cmdArgs...)
+	var cmdErr bytes.Buffer
+	cmd.Stderr = &cmdErr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git command: %s", err))
+	}
+	if err := cmd.Start(); err != nil {
+		// Already stopped before git could be started
+		if ctx.Err() != nil {
+			return
+		}
 		mainLogger.Fatal(fmt.Sprintf("There was an error running git command: %s", err))
 	}
-	outputStr := string(cmdOut)
-	// mainLogger.Debugf("Output from command: %s", outputStr)
 
-	scanner := bufio.NewScanner(strings.NewReader(outputStr))
-	first := true
-	commit := Commit{}
+	var commit *Commit
 	comment := ""
+	numstats := 0
 
-	Commits = make(map[string]Commit)
-
-	var matchFiles []core.MatchFile
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "commit") {
-			if first {
-				first = false
-			} else {
-				commit.comment = strings.TrimSpace(comment)
-				commit.matchFiles = matchFiles
-				matchFiles = nil
-				Commits[commit.id] = commit
-				commit = Commit{}
-				comment = ""
+	finishCommit := func() {
+		if commit == nil {
+			return
+		}
+		commit.comment = strings.TrimSpace(comment)
+		for _, change := range commit.changes {
+			commit.matchFiles = append(commit.matchFiles, core.NewMatchFile(change.path))
+		}
+		if commit.Wanted() {
+			if _, found := Commits[commit.id]; !found {
+				CommitOrder = append(CommitOrder, commit.id)
+			}
+			Commits[commit.id] = *commit
+			progress.CommitParsed()
+			if found != nil {
+				found(*commit)
 			}
+		}
+		commit = nil
+		comment = ""
+		numstats = 0
+	}
+
+	// Not using a Scanner as that gives up on lines over 64KB, which
+	// long commit messages and generated file names can go over
+	reader := bufio.NewReader(stdout)
+	for {
+		line, readErr := reader.ReadString('\n')
+		line = strings.TrimSuffix(line, "\n")
+
+		if commitLineRegexp.MatchString(line) {
+			finishCommit()
 			//	mainLogger.Debugf("Commit ID: %s\n", line)
-			commit.id = strings.TrimPrefix(line, "commit ")
+			ids := strings.Fields(strings.TrimPrefix(line, "commit "))
+			commit = &Commit{id: ids[0], submodule: repository.submodule}
+			for _, id := range ids[1:] {
+				if !commitIDRegexp.MatchString(id) {
+					break
+				}
+				commit.parents = append(commit.parents, id)
+			}
+		} else if commit == nil {
+			// Nothing should come before the first commit
+		} else if strings.HasPrefix(line, "Merge:") {
+			// Already have the parents in full
 		} else if strings.HasPrefix(line, "Author:    ") {
 			commit.author = strings.TrimPrefix(line, "Author:     ")
 		} else if strings.HasPrefix(line, "AuthorDate:") {
@@ -180,191 +561,192 @@ func main() {
 			commit.CommitDate(line)
 		} else if strings.HasPrefix(line, "    ") {
 			comment = comment + strings.TrimSpace(line) + "\n"
-		} else {
-			if line != "" {
-				matchFile := core.NewMatchFile(line)
-				matchFiles = append(matchFiles, matchFile)
+		} else if strings.HasPrefix(line, ":") {
+			if change, ok := ParseRawLine(line); ok {
+				commit.changes = append(commit.changes, change)
+			} else {
+				mainLogger.Debugf("Could not parse file change: %s", line)
+			}
+		} else if matchBits := numstatLineRegexp.FindStringSubmatch(line); matchBits != nil {
+			// The stats come in the same order as the changes
+			if numstats < len(commit.changes) {
+				commit.changes[numstats].SetLineStats(matchBits[1], matchBits[2])
+			}
+			numstats++
+		}
+
+		if readErr != nil {
+			if readErr != io.EOF && ctx.Err() == nil {
+				mainLogger.Fatal(fmt.Sprintf("There was an error reading from git command: %s", readErr))
 			}
+			break
 		}
 	}
+	finishCommit()
 
-	commit.matchFiles = matchFiles
-	commit.comment = strings.TrimSpace(comment)
-	Commits[commit.id] = commit
-	var grepOutputRegexp *regexp.Regexp
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git command: %s: %s", err, strings.TrimSpace(cmdErr.String())))
+	}
+}
 
-	if *dumpPtr {
-		pos := len(Commits)
-		for _, c := range Commits {
-			outputDestination.WriteString(fmt.Sprintf("Commit Number: %d\n", pos))
-			c.PrintCommit()
-			pos = pos - 1
-		}
-	} else {
-		// Have to define this outside the next block so it is available later
-		var revisionSliceChunks [][]string
-
-		// Only need to pull the list of revisions out once
-		// and only if doing a grep
-		if doGrep {
-			revList := ""
-			var (
-				revCmdOut []byte
-				err       error
-			)
-
-			revCmdName := "git"
-			revCmdArgs := []string{"rev-list", "--all"}
-			if gitDir != "" {
-				revCmdArgs = append([]string{fmt.Sprintf("--git-dir=%s", gitDir)}, revCmdArgs...)
-			}
+// Pulls the list of revisions out of a repository and splits it into
+// chunks ready to be passed to git grep
+func GetRevisionChunks(ctx context.Context, repository Repository) [][]string {
+	var revisionSliceChunks [][]string
 
-			mainLogger.Debug("Running git rev-list")
-			mainLogger.Debugf("Command arguments are: %s", revCmdArgs)
+	revList := ""
+	var (
+		revCmdOut []byte
+		err       error
+	)
 
-			if revCmdOut, err = exec.Command(revCmdName, revCmdArgs...).Output(); err != nil {
-				mainLogger.Fatal(fmt.Sprintf("There was an error running git rev-list command: %s", err))
-			}
-			revList = string(revCmdOut)
-
-			// If there is a new line on the end, it creates an empty element at the end of the slice.
-			// That is then passed as an empty argument to git which causes it to fail, even though it is nothing
-			// So remove the trailing new line before splitting it and everything works.
-			// Nearly an hour of debugging time to find this!
-			if revList[len(revList)-1:] == "\n" {
-				revList = revList[:len(revList)-1]
-			}
-			var revisionsSlice []string
-			revisionsSlice = strings.Split(revList, "\n")
-			// The higher this number, the more revisions grep will search at once
-			// but the longer it will take doing it and so the output will look
-			// jerky.
-			chunkSize := 100
-			for len(revisionsSlice) > chunkSize {
-				revisionSliceChunks = append(revisionSliceChunks, revisionsSlice[0:chunkSize])
-				revisionsSlice = revisionsSlice[chunkSize:len(revisionsSlice)]
-			}
-			revisionSliceChunks = append(revisionSliceChunks, revisionsSlice)
+	revCmdName := "git"
+	revCmdArgs := []string{"rev-list"}
+	revCmdArgs = append(revCmdArgs, RevisionArgs(repository)...)
+	if repository.gitDir != "" {
+		revCmdArgs = append([]string{fmt.Sprintf("--git-dir=%s", repository.gitDir)}, revCmdArgs...)
+	}
+
+	mainLogger.Debug("Running git rev-list")
+	mainLogger.Debugf("Command arguments are: %s", revCmdArgs)
 
-			// Naming these but not using the names at the moment. For more info see:
-			// https://github.com/StefanSchroeder/Golang-Regex-Tutorial/blob/master/01-chapter2.markdown#named-matches
-			grepOutputRegexpStr := "^(?P<ID>[a-f0-9]*):(?P<File>[^:]*):(?P<Message>.*)$"
-			grepOutputRegexp = regexp.MustCompile(grepOutputRegexpStr)
+	if revCmdOut, err = exec.CommandContext(ctx, revCmdName, revCmdArgs...).Output(); err != nil {
+		if ctx.Err() != nil {
+			return revisionSliceChunks
 		}
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git rev-list command: %s", err))
+	}
+	revList = string(revCmdOut)
 
-		var wg sync.WaitGroup
+	if revList == "" {
+		return revisionSliceChunks
+	}
 
-		done := make(chan bool)
-		go printHits(done)
+	// If there is a new line on the end, it creates an empty element at the end of the slice.
+	// That is then passed as an empty argument to git which causes it to fail, even though it is nothing
+	// So remove the trailing new line before splitting it and everything works.
+	// Nearly an hour of debugging time to find this!
+	if revList[len(revList)-1:] == "\n" {
+		revList = revList[:len(revList)-1]
+	}
+	var revisionsSlice []string
+	// Only the commits which made it through the author filters
+	for _, revision := range strings.Split(revList, "\n") {
+		if _, found := Commits[revision]; found {
+			revisionsSlice = append(revisionsSlice, revision)
+		}
+	}
+	if len(revisionsSlice) == 0 {
+		return revisionSliceChunks
+	}
+	// The higher this number, the more revisions grep will search at once
+	// but the longer it will take doing it and so the output will look
+	// jerky.
+	chunkSize := 100
+	for len(revisionsSlice) > chunkSize {
+		revisionSliceChunks = append(revisionSliceChunks, revisionsSlice[0:chunkSize])
+		revisionsSlice = revisionsSlice[chunkSize:len(revisionsSlice)]
+	}
+	revisionSliceChunks = append(revisionSliceChunks, revisionsSlice)
 
-		for _, commit := range Commits {
-			for _, signature := range CommentSignatures {
-				/*
-				   These are not guaranteed to all finish if the app finishes first.
-				   Need to move them to channels and waitgroups
+	return revisionSliceChunks
+}
 
-				   https://golangbot.com/channels/
-				   https://golangbot.com/buffered-channels-worker-pools/
-				*/
+var hitsChannel = make(chan Hit, 10)
 
-				// Check the commit messages
-				wg.Add(1)
-				go CommitMessageSearch(&wg, commit, signature)
-
-				// Now checking for file contents
-				if doGrep {
-					//wg.Add(1)
-					/*
-					   Deliberately not doing this in a thread as git grep opens a lot of file handles
-					   and so break things if ran concurrently.
-					*/
-					for _, chunk := range revisionSliceChunks {
-						GrepSearch(commit, signature, chunk, gitDir, grepOutputRegexp)
-					}
-				}
+// Hits are passed on to the sinks as they come in when not sorting,
+// otherwise they are held until everything has been found. The findings
+// from the last run go after the new ones so that anything which has
+// changed since, such as a file which has now been deleted, replaces
+// the old version rather than being reported twice.
+func printHits(previousFindings []Hit, done chan bool) {
+	// When keeping state, the same things get found every run
+	seen := make(map[string]bool)
+	var hits []Hit
+
+	report := func(hit Hit) {
+		if scanState != nil {
+			if seen[hit.Key()] {
+				return
 			}
-			// Finally check filenames
-			wg.Add(1)
-			go FilenameSearch(&wg, commit)
+			seen[hit.Key()] = true
 		}
-		wg.Wait()
-		close(hitsChannel)
-		<-done
-		if !SomethingFound {
-			outputDestination.WriteString(fmt.Sprintln("Sorry, no interesting information found"))
+
+		if hit.Severity == "" {
+			hit.Severity = defaultSeverity(hit.Type)
+		}
+		if scanState != nil && hit.InHistory() {
+			scanState.AddFinding(hit)
 		}
-	}
-}
 
-type Hit struct {
-	/*
-		Might be better to pass a structure back
-		so the output can do some nice processing on it,
-		but for now, a string to print will do.
-
-		hitType   string
-		commit    Commit
-		signature core.Signature
-	*/
-	output string
-}
+		// The state keeps the real values so later runs match them up
+		if redactor != nil {
+			hit = redactor.Redact(hit)
+		}
 
-var hitsChannel = make(chan Hit, 10)
+		results.Add(hit)
+		progress.HitFound()
+		if extractor != nil {
+			extractor.Extract(hit)
+		}
 
-func printHits(done chan bool) {
-	for hit := range hitsChannel {
-		outputDestination.WriteString(fmt.Sprintf(hit.output))
+		if sortOrder != SortNone {
+			hits = append(hits, hit)
+			return
+		}
+
+		for _, sink := range outputSinks {
+			sink.Hit(hit)
+		}
 		//fmt.Printf("Hit from the hits channel: %s\n", hit.commit.id)
 	}
-	done <- true
-}
 
-func FilenameSearch(wg *sync.WaitGroup, commit Commit) {
-	for _, signature := range core.Signatures {
-		for _, file := range commit.matchFiles {
-			if signature.Match(file) {
-				output := ""
-				output += fmt.Sprintln(au.Bold(au.Blue("File Match")))
-				output += fmt.Sprintf("Description: %s\n", signature.Description())
-				if signature.Comment() != "" {
-					output += fmt.Sprintf("Comment: %s\n", signature.Comment())
-				}
-				output += fmt.Sprintf("Hit on file: %s\n", file.Path)
-				output += commit.GetCommitString()
+	for hit := range hitsChannel {
+		report(hit)
+	}
+	for _, hit := range previousFindings {
+		// Older state files kept everything, anything which is still
+		// there will have been found again
+		if hit.InHistory() {
+			report(hit)
+		}
+	}
 
-				mainLogger.Debugf("Adding FilenameSearch result with commit ID %s to channel", commit.id)
-				hit := Hit{output}
-				hitsChannel <- hit
+	SortHits(hits, sortOrder)
+	for _, hit := range hits {
+		for _, sink := range outputSinks {
+			sink.Hit(hit)
+		}
+	}
 
-				SomethingFound = true
-			}
+	if extractor != nil {
+		if err := extractor.WriteManifest(); err != nil {
+			mainLogger.Errorf("Error writing the extract manifest: %s", err)
 		}
 	}
-	wg.Done()
+	done <- true
 }
 
-func CommitMessageSearch(wg *sync.WaitGroup, commit Commit, signature CommentSignature) {
+func CommitMessageSearch(commit Commit, signature CommentSignature) {
 	if signature.Match(commit.comment) {
-		output := ""
-		output += fmt.Sprintln(au.Bold(au.Red("Commit Match")))
-		output += fmt.Sprintf("Description: %s\n", signature.GetDescription())
-		if signature.GetComment() != "" {
-			output += fmt.Sprintf("Comment: %s\n", signature.GetComment())
+		hit := Hit{
+			Type:        CommitMatch,
+			Severity:    signature.GetSeverity(),
+			Description: signature.GetDescription(),
+			Comment:     signature.GetComment(),
+			Commit:      &commit,
 		}
-		output += commit.GetCommitString()
 
 		mainLogger.Debugf("Adding CommitMessageSearch result with commit ID %s to channel", commit.id)
-		hit := Hit{output}
 		hitsChannel <- hit
-
-		SomethingFound = true
 	}
-
-	wg.Done()
 }
 
-//func GrepSearch(wg *sync.WaitGroup, commit Commit, signature CommentSignature, revisionsSlice []string, gitDir string, grepOutputRegexp *regexp.Regexp) {
-func GrepSearch(commit Commit, signature CommentSignature, revisionsSlice []string, gitDir string, grepOutputRegexp *regexp.Regexp) {
+// Output is asked for with NULs after the file name and line number as
+// either could have colons in them
+func GrepSearch(ctx context.Context, signature CommentSignature, revisionsSlice []string, gitDir string) {
+	defer progress.ChunkDone()
+
 	var (
 		cmdOut []byte
 		err    error
@@ -376,9 +758,9 @@ func GrepSearch(commit Commit, signature CommentSignature, revisionsSlice []stri
 	// Need to check for prefix of (?i) and if found, strip and add a -i to grep
 	if signature.GetPattern()[0:4] == "(?i)" {
 		pattern := strings.Replace(signature.GetPattern(), "(?i)", "", 1)
-		cmdArgs = []string{"grep", "-i", "-E", pattern}
+		cmdArgs = []string{"grep", "-z", "-n", "-i", "-E", pattern}
 	} else {
-		cmdArgs = []string{"grep", "-E", signature.GetPattern()}
+		cmdArgs = []string{"grep", "-z", "-n", "-E", signature.GetPattern()}
 	}
 
 	for _, revisionId := range revisionsSlice {
@@ -395,7 +777,7 @@ func GrepSearch(commit Commit, signature CommentSignature, revisionsSlice []stri
 
 	// If there are no matches, git will return 1
 	// Matches have a return code of 0
-	cmdOut, err = exec.Command(cmdName, cmdArgs...).Output()
+	cmdOut, err = exec.CommandContext(ctx, cmdName, cmdArgs...).Output()
 
 	if err != nil {
 		mainLogger.Debugf("err: %s", err.Error())
@@ -408,31 +790,62 @@ func GrepSearch(commit Commit, signature CommentSignature, revisionsSlice []stri
 		}
 		cmdOutMap := strings.Split(cmdOutStr, "\n")
 
-		for _, commitLine := range cmdOutMap {
-			output := ""
+		// Each file is only fetched once however many matches it has
+		fileLines := make(map[string][]string)
 
-			output += fmt.Sprintln(au.Bold(au.Green("Grep Match")))
+		for _, commitLine := range cmdOutMap {
 			//	mainLogger.Debugf("Commit line: %s", commitLine)
-			//	mainLogger.Debugf("Commit line: %s", grepOutputRegexp)
-			matchBits := grepOutputRegexp.FindStringSubmatch(commitLine)
-			if len(matchBits) == 4 {
-				commit := Commits[matchBits[1]]
-				output += commit.GetCommitString()
-				output += fmt.Sprintf("Match In File: %s\n", matchBits[2])
-				output += fmt.Sprintf("Matching Line: %s\n\n", matchBits[3])
+			// Lines look like <commit ID>:<file>\0<line number>\0<line>
+			matchBits := strings.SplitN(commitLine, "\x00", 3)
+			if len(matchBits) == 3 && len(matchBits[0]) > 41 {
+				commit := Commits[matchBits[0][0:40]]
+				lineNumber, _ := strconv.Atoi(matchBits[1])
+				hit := Hit{
+					Type:        GrepMatch,
+					Severity:    signature.GetSeverity(),
+					Description: signature.GetDescription(),
+					Commit:      &commit,
+					File:        matchBits[0][41:],
+					Line:        matchBits[2],
+					LineNumber:  lineNumber,
+				}
+
+				if contextLines > 0 {
+					lines, found := fileLines[matchBits[0]]
+					if !found {
+						lines = GetBlobLines(ctx, gitDir, matchBits[0])
+						fileLines[matchBits[0]] = lines
+					}
+					hit.Context = GetContext(lines, lineNumber)
+				}
 
 				mainLogger.Debugf("Adding GrepSearch result with commit ID %s to channel", commit.id)
-				hit := Hit{output}
 				hitsChannel <- hit
 			}
 		}
 
 	} else if err.Error() == "exit status 1" {
 		// Don't bail on 1
+	} else if ctx.Err() != nil {
+		// Killed as the scan has been stopped
 	} else {
 		mainLogger.Fatal(fmt.Sprintf("There was an error running git grep command: %s", err))
 	}
 	//	outputStr := string(cmdOut)
 	//	mainLogger.Debugf("Output from command: %s", outputStr)
-	//wg.Done()
+}
+
+// The content of a file at a commit, the revision is <commit ID>:<file>
+func GetBlobLines(ctx context.Context, gitDir string, revision string) []string {
+	cmdName := "git"
+	cmdArgs := []string{fmt.Sprintf("--git-dir=%s", gitDir), "cat-file", "blob", revision}
+
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	cmdOut, err := exec.CommandContext(ctx, cmdName, cmdArgs...).Output()
+	if err != nil {
+		mainLogger.Debugf("Could not get the content of %s: %s", revision, err)
+		return nil
+	}
+	return SplitLines(cmdOut)
 }
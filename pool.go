@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Runs tasks on a fixed number of goroutines. The queue is only a little
+// bigger than the number of workers so Submit blocks rather than
+// building up a huge backlog of tasks on a big repository. Once the
+// context is done, anything still queued is thrown away.
+type WorkerPool struct {
+	ctx   context.Context
+	tasks chan func()
+	wg    sync.WaitGroup
+}
+
+func NewWorkerPool(ctx context.Context, workers int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	pool := &WorkerPool{ctx: ctx, tasks: make(chan func(), workers*2)}
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for task := range pool.tasks {
+				if ctx.Err() != nil {
+					continue
+				}
+				task()
+			}
+		}()
+	}
+
+	return pool
+}
+
+// Nothing new is started once the scan has been stopped
+func (p *WorkerPool) Submit(task func()) {
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	wrapped := func() {
+		task()
+		progress.TaskDone()
+	}
+	select {
+	case p.tasks <- wrapped:
+		progress.TaskAdded()
+	case <-p.ctx.Done():
+	}
+}
+
+// Waits for everything submitted to finish, nothing can be submitted
+// after this has been called
+func (p *WorkerPool) Wait() {
+	close(p.tasks)
+	p.wg.Wait()
+}
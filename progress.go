@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ProgressAuto = "auto"
+	ProgressOn   = "on"
+	ProgressOff  = "off"
+	ProgressJSON = "json"
+)
+
+// Counters for the progress display, updated from all over the place
+// so they are all atomic
+type Progress struct {
+	commits     atomic.Int64
+	tasksTotal  atomic.Int64
+	tasksDone   atomic.Int64
+	chunksTotal atomic.Int64
+	chunksDone  atomic.Int64
+	blobsTotal  atomic.Int64
+	blobsDone   atomic.Int64
+	hits        atomic.Int64
+
+	mode  string
+	start time.Time
+	lock  sync.Mutex
+	stop  chan bool
+	done  chan bool
+}
+
+// The status events written in JSON mode
+type ProgressEvent struct {
+	Event          string `json:"event"`
+	Commits        int64  `json:"commits"`
+	ChunksTotal    int64  `json:"chunks_total"`
+	ChunksDone     int64  `json:"chunks_done"`
+	BlobsTotal     int64  `json:"blobs_total"`
+	BlobsDone      int64  `json:"blobs_done"`
+	Hits           int64  `json:"hits"`
+	ElapsedSeconds int64  `json:"elapsed_seconds"`
+	ETASeconds     int64  `json:"eta_seconds"`
+}
+
+var progress = &Progress{mode: ProgressOff}
+
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Starts showing progress on stderr, in auto mode only if stderr is a
+// terminal as anything else would end up full of control codes
+func (p *Progress) Start(mode string) {
+	switch mode {
+	case ProgressAuto:
+		if stderrIsTerminal() {
+			mode = ProgressOn
+		} else {
+			mode = ProgressOff
+		}
+	case ProgressOn, ProgressOff, ProgressJSON:
+	default:
+		mainLogger.Fatalf("Unknown progress option, expecting auto, on, off or json: %s", mode)
+	}
+
+	p.mode = mode
+	p.start = time.Now()
+	if p.mode == ProgressOff {
+		return
+	}
+
+	interval := 500 * time.Millisecond
+	if p.mode == ProgressJSON {
+		interval = 5 * time.Second
+	}
+
+	p.stop = make(chan bool)
+	p.done = make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.show("progress")
+			case <-p.stop:
+				p.show("finished")
+				p.done <- true
+				return
+			}
+		}
+	}()
+}
+
+func (p *Progress) Stop() {
+	if p.mode == ProgressOff {
+		return
+	}
+	p.stop <- true
+	<-p.done
+}
+
+func (p *Progress) CommitParsed()     { p.commits.Add(1) }
+func (p *Progress) TaskAdded()        { p.tasksTotal.Add(1) }
+func (p *Progress) TaskDone()         { p.tasksDone.Add(1) }
+func (p *Progress) ChunksAdded(n int) { p.chunksTotal.Add(int64(n)) }
+func (p *Progress) ChunkDone()        { p.chunksDone.Add(1) }
+func (p *Progress) BlobsAdded(n int)  { p.blobsTotal.Add(int64(n)) }
+func (p *Progress) BlobDone()         { p.blobsDone.Add(1) }
+func (p *Progress) HitFound()         { p.hits.Add(1) }
+
+// Based on how long the chunks and blobs searched so far have taken as
+// those are all known about up front. The pool only queues a few tasks
+// at a time so they are only used until the content searches start.
+func (p *Progress) eta() time.Duration {
+	total := p.chunksTotal.Load() + p.blobsTotal.Load()
+	done := p.chunksDone.Load() + p.blobsDone.Load()
+	if total == 0 {
+		total = p.tasksTotal.Load()
+		done = p.tasksDone.Load()
+	}
+
+	remaining := total - done
+	if done == 0 || remaining <= 0 {
+		return 0
+	}
+	elapsed := time.Since(p.start)
+	return time.Duration(float64(elapsed) / float64(done) * float64(remaining)).Round(time.Second)
+}
+
+func (p *Progress) show(event string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.mode == ProgressJSON {
+		data, _ := json.Marshal(ProgressEvent{
+			Event:          event,
+			Commits:        p.commits.Load(),
+			ChunksTotal:    p.chunksTotal.Load(),
+			ChunksDone:     p.chunksDone.Load(),
+			BlobsTotal:     p.blobsTotal.Load(),
+			BlobsDone:      p.blobsDone.Load(),
+			Hits:           p.hits.Load(),
+			ElapsedSeconds: int64(time.Since(p.start).Seconds()),
+			ETASeconds:     int64(p.eta().Seconds()),
+		})
+		fmt.Fprintln(os.Stderr, string(data))
+		return
+	}
+
+	eta := "unknown"
+	if event == "finished" {
+		eta = "done"
+	} else if p.eta() > 0 {
+		eta = p.eta().String()
+	}
+
+	// \r and \033[K put the cursor back at the start and clear the line
+	fmt.Fprintf(os.Stderr, "\r\033[KCommits: %d | Chunks grepped: %d/%d | Blobs scanned: %d/%d | Hits: %d | ETA: %s",
+		p.commits.Load(), p.chunksDone.Load(), p.chunksTotal.Load(), p.blobsDone.Load(), p.blobsTotal.Load(), p.hits.Load(), eta)
+	if event == "finished" {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// Gets the progress line out of the way before anything else is written
+// to the terminal, it comes back on the next update
+func (p *Progress) Clear() {
+	if p.mode != ProgressOn {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	fmt.Fprint(os.Stderr, "\r\033[K")
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Formats the findings can be written in, other than text they are all
+// written in one go once the scan has finished
+var findingsFormats = []string{FormatText, FormatHTML, FormatMarkdown, FormatCSV, FormatJSON, FormatJSONL}
+
+// The details of a hit flattened out, with the commit fields pulled up,
+// so every report format is built from the same thing
+type ReportHit struct {
+	Type       string
+	Severity   string
+	Rule       string
+	Comment    string
+	Submodule  string
+	CommitID   string
+	Author     string
+	Committer  string
+	Date       time.Time
+	Message    string
+	Refs       []string
+	Path       string
+	LineNumber int
+	Match      string
+	Context    []ContextLine
+	Fields     []HitField
+}
+
+func NewReportHit(hit Hit) ReportHit {
+	r := ReportHit{
+		Type:       hit.Type,
+		Severity:   hit.Severity,
+		Rule:       hit.Description,
+		Comment:    hit.Comment,
+		Submodule:  hit.Submodule,
+		Path:       hit.File,
+		LineNumber: hit.LineNumber,
+		Match:      hit.Line,
+		Context:    hit.Context,
+		Fields:     hit.Fields,
+	}
+	if hit.Commit != nil {
+		r.Submodule = hit.Commit.submodule
+		r.CommitID = hit.Commit.id
+		r.Author = hit.Commit.author
+		r.Committer = hit.Commit.commit
+		r.Date = hit.Commit.commitDate
+		r.Message = hit.Commit.comment
+		r.Refs = hit.Commit.refs
+	}
+	return r
+}
+
+// The lines around the match with the match itself in its place
+func (r ReportHit) ContextWithMatch() []ContextLine {
+	var lines []ContextLine
+	shownMatch := false
+	for _, line := range r.Context {
+		if !shownMatch && line.Number > r.LineNumber {
+			lines = append(lines, ContextLine{r.LineNumber, r.Match})
+			shownMatch = true
+		}
+		lines = append(lines, line)
+	}
+	if !shownMatch {
+		lines = append(lines, ContextLine{r.LineNumber, r.Match})
+	}
+	return lines
+}
+
+// What is known about the scan as a whole
+type ReportDetails struct {
+	Repository string
+	Generated  time.Time
+	// Why the scan stopped early, empty if it finished
+	Incomplete string
+}
+
+// Goes with the hits in the JSON report, and is the last line of the
+// JSONL one, so a partial scan can't be taken for a full one
+type reportStatus struct {
+	Repository       string    `json:"repository"`
+	Generated        time.Time `json:"generated"`
+	Incomplete       bool      `json:"incomplete"`
+	IncompleteReason string    `json:"incomplete_reason,omitempty"`
+}
+
+func newReportStatus(details ReportDetails) reportStatus {
+	return reportStatus{
+		Repository:       details.Repository,
+		Generated:        details.Generated,
+		Incomplete:       details.Incomplete != "",
+		IncompleteReason: details.Incomplete,
+	}
+}
+
+type jsonReport struct {
+	reportStatus
+	Findings []Hit `json:"findings"`
+}
+
+type jsonlStatus struct {
+	Type string `json:"type"`
+	reportStatus
+	FindingCount int `json:"finding_count"`
+}
+
+func WriteFindings(w io.Writer, format string, hits []Hit, details ReportDetails) error {
+	var reportHits []ReportHit
+	for _, hit := range hits {
+		reportHits = append(reportHits, NewReportHit(hit))
+	}
+
+	switch format {
+	case FormatHTML:
+		return WriteHTMLReport(w, reportHits, details)
+	case FormatMarkdown:
+		return WriteMarkdownReport(w, reportHits, details)
+	case FormatCSV:
+		return WriteCSVReport(w, reportHits, details)
+	case FormatJSON:
+		// The hits as they are, the same as in the state file
+		report := jsonReport{newReportStatus(details), hits}
+		if report.Findings == nil {
+			report.Findings = []Hit{}
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case FormatJSONL:
+		for _, hit := range hits {
+			data, err := json.Marshal(hit)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return err
+			}
+		}
+		status := jsonlStatus{"Scan Status", newReportStatus(details), len(hits)}
+		data, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+	return nil
+}
+
+// The columns both the Markdown and CSV reports have, one row per hit
+var reportColumns = []string{"type", "rule", "severity", "commit", "author", "date", "submodule", "path", "line", "match"}
+
+func (r ReportHit) row(dateFormat string) []string {
+	date := ""
+	if !r.Date.IsZero() {
+		date = r.Date.Format(dateFormat)
+	}
+	line := ""
+	if r.LineNumber > 0 {
+		line = fmt.Sprint(r.LineNumber)
+	}
+	return []string{r.Type, r.Rule, r.Severity, r.CommitID, r.Author, date, r.Submodule, r.Path, line, r.Match}
+}
+
+// The values come from the repository being scanned, which could have
+// been set up to attack whoever opens the report, so anything a
+// spreadsheet would take as a formula is quoted to keep it as text
+func csvSafe(row []string) []string {
+	for pos, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[pos] = "'" + cell
+		}
+	}
+	return row
+}
+
+// A partial scan gets an extra row at the end saying why it stopped
+func WriteCSVReport(w io.Writer, hits []ReportHit, details ReportDetails) error {
+	writer := csv.NewWriter(w)
+	writer.Write(reportColumns)
+	for _, hit := range hits {
+		writer.Write(csvSafe(hit.row(time.RFC3339)))
+	}
+	if details.Incomplete != "" {
+		status := ReportHit{Type: "Scan Incomplete", Rule: details.Incomplete, Date: details.Generated}
+		writer.Write(csvSafe(status.row(time.RFC3339)))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Anything which would be taken as formatting, pipes would end the cell
+// early and a new line the table
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]", "<", "\\<", ">", "\\>", "|", "\\|",
+	"\r\n", " ", "\n", " ", "\r", " ",
+)
+
+// A code span needs more backticks around it than are in a row inside it
+func markdownCode(text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + strings.ReplaceAll(text, "|", "\\|") + fence
+}
+
+// A heading and a table which can be pasted straight into a ticket
+func WriteMarkdownReport(w io.Writer, hits []ReportHit, details ReportDetails) error {
+	output := "# GitHunter Findings\n\n"
+	output += fmt.Sprintf("Repository: %s  \n", markdownEscaper.Replace(details.Repository))
+	output += fmt.Sprintf("Generated: %s  \n", details.Generated.Format("2006-01-02 15:04:05 MST"))
+	output += fmt.Sprintf("Findings: %d\n\n", len(hits))
+	if details.Incomplete != "" {
+		output += fmt.Sprintf("**The scan stopped early as %s, these findings only cover part of the repository.**\n\n", details.Incomplete)
+	}
+
+	if len(hits) == 0 {
+		output += "No interesting information found.\n"
+		_, err := io.WriteString(w, output)
+		return err
+	}
+
+	output += "| " + strings.Join(reportColumns, " | ") + " |\n"
+	output += strings.Repeat("| --- ", len(reportColumns)) + "|\n"
+	for _, hit := range hits {
+		cells := hit.row("2006-01-02 15:04:05")
+		for pos, cell := range cells {
+			cells[pos] = markdownEscaper.Replace(cell)
+		}
+		// Shown as it is
+		if hit.Match != "" {
+			cells[len(cells)-1] = markdownCode(hit.Match)
+		}
+		output += "| " + strings.Join(cells, " | ") + " |\n"
+	}
+
+	_, err := io.WriteString(w, output)
+	return err
+}
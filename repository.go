@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type Repository struct {
+	gitDir   string
+	workTree string
+	// Path of the submodule within the top level repository,
+	// empty for the top level repository itself
+	submodule string
+}
+
+// Finds any initialised submodules, and their submodules, so they can be
+// scanned along with the parent. Submodules which have not been initialised
+// have nothing under .git/modules and so there is nothing to scan.
+func FindSubmodules(ctx context.Context, repository Repository) []Repository {
+	var submodules []Repository
+
+	cmdName := "git"
+	cmdArgs := []string{fmt.Sprintf("--git-dir=%s", repository.gitDir), "config"}
+
+	// Prefer the checked out copy of .gitmodules as that is what was used
+	// to set things up, fall back to the committed one for bare repositories
+	gitmodules := ""
+	if repository.workTree != "" {
+		gitmodules = filepath.Join(repository.workTree, ".gitmodules")
+	}
+	if _, err := os.Stat(gitmodules); gitmodules != "" && err == nil {
+		cmdArgs = append(cmdArgs, "--file", gitmodules)
+	} else {
+		cmdArgs = append(cmdArgs, "--blob", "HEAD:.gitmodules")
+	}
+	cmdArgs = append(cmdArgs, "--get-regexp", `^submodule\..*\.path$`)
+
+	mainLogger.Debug("Looking for submodules")
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	// Fails if there is no .gitmodules, which is the usual case
+	cmdOut, err := exec.CommandContext(ctx, cmdName, cmdArgs...).Output()
+	if err != nil {
+		mainLogger.Debugf("No submodules found: %s", err)
+		return submodules
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(cmdOut)), "\n") {
+		// Lines look like: submodule.<name>.path <path>
+		key, subPath, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+
+		submodule := Repository{
+			gitDir:    filepath.Join(repository.gitDir, "modules", name),
+			submodule: path.Join(repository.submodule, subPath),
+		}
+
+		if _, err := os.Stat(submodule.gitDir); err != nil {
+			mainLogger.Infof("Submodule %s has not been initialised so can't be scanned", submodule.submodule)
+			continue
+		}
+
+		if repository.workTree != "" {
+			workTree := filepath.Join(repository.workTree, subPath)
+			if _, err := os.Stat(workTree); err == nil {
+				submodule.workTree = workTree
+			}
+		}
+
+		mainLogger.Debugf("Found submodule %s in %s", submodule.submodule, submodule.gitDir)
+		submodules = append(submodules, submodule)
+		submodules = append(submodules, FindSubmodules(ctx, submodule)...)
+	}
+
+	return submodules
+}
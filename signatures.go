@@ -21,12 +21,14 @@ type CommentSignature interface {
 	GetDescription() string
 	GetComment() string
 	GetPattern() string
+	GetSeverity() string
 }
 
 type SimpleCommentSignature struct {
 	Pattern     string
 	Description string
 	Comment     string
+	Severity    string
 }
 
 func (p *PatternCommentSignature) CompileRegexp() {
@@ -38,6 +40,7 @@ type PatternCommentSignature struct {
 	Pattern     string
 	Description string
 	Comment     string
+	Severity    string
 }
 
 func (s SimpleCommentSignature) GetComment() string {
@@ -64,6 +67,16 @@ func (s PatternCommentSignature) GetDescription() string {
 	return s.Description
 }
 
+// Empty if the patterns file doesn't give one, the hit then gets the
+// default for its type
+func (s SimpleCommentSignature) GetSeverity() string {
+	return s.Severity
+}
+
+func (s PatternCommentSignature) GetSeverity() string {
+	return s.Severity
+}
+
 func (s SimpleCommentSignature) Match(comment string) bool {
 	return ContainsI(comment, s.Pattern)
 }
@@ -79,6 +92,12 @@ type JSONPatterns struct {
 	Simples  []SimpleCommentSignature
 }
 
+func checkSeverity(severity string, pattern string) {
+	if _, found := severityRanks[severity]; severity != "" && !found {
+		mainLogger.Fatalf("Unknown severity %s for pattern %s, expecting high, medium or low", severity, pattern)
+	}
+}
+
 func ParsePatternsFile(patternsFile string) bool {
 	mainLogger.Debug("Starting JSON patterns file parsing")
 	var jsonPatterns JSONPatterns
@@ -96,6 +115,7 @@ func ParsePatternsFile(patternsFile string) bool {
 	json.Unmarshal(byteValue, &jsonPatterns)
 
 	for _, pattern := range jsonPatterns.Simples {
+		checkSeverity(pattern.Severity, pattern.Pattern)
 		CommentSignatures = append(CommentSignatures, pattern)
 	}
 
@@ -103,6 +123,7 @@ func ParsePatternsFile(patternsFile string) bool {
 		// Doing this to compile the string in the JSON file into a
 		// regexp that can then be used by the match function
 		pattern.CompileRegexp()
+		checkSeverity(pattern.Severity, pattern.Pattern)
 		CommentSignatures = append(CommentSignatures, pattern)
 	}
 
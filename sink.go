@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Somewhere the findings get written. Hits are passed on in the order
+// they are to be shown, Finish is called once the scan is over.
+type OutputSink interface {
+	Hit(hit Hit)
+	Finish(details ReportDetails) error
+	Close() error
+}
+
+// Every sink gets every hit, set up from the command line
+var outputSinks []OutputSink
+
+// The colour codes aurora adds
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Writes each hit as soon as it is given it, followed by the summary.
+// Files from -out don't get colours, they would just be escape codes.
+type textSink struct {
+	file     *os.File
+	coloured bool
+}
+
+func (s *textSink) write(text string) {
+	if !s.coloured {
+		text = ansiRegexp.ReplaceAllString(text, "")
+	}
+	s.file.WriteString(text)
+}
+
+func (s *textSink) Hit(hit Hit) {
+	progress.Clear()
+	s.write(hit.GetHitString())
+}
+
+func (s *textSink) Finish(details ReportDetails) error {
+	if details.Incomplete != "" {
+		s.write("Scan incomplete as " + details.Incomplete + ", these results only cover part of the repository\n\n")
+	}
+	if results.Total() == 0 {
+		s.write("Sorry, no interesting information found\n")
+	} else {
+		s.write(results.GetSummaryString())
+	}
+	return nil
+}
+
+func (s *textSink) Close() error {
+	return closeOutput(s.file)
+}
+
+// The other formats need everything before they can be written
+type reportSink struct {
+	file   *os.File
+	format string
+	hits   []Hit
+}
+
+func (s *reportSink) Hit(hit Hit) {
+	s.hits = append(s.hits, hit)
+}
+
+func (s *reportSink) Finish(details ReportDetails) error {
+	return WriteFindings(s.file, s.format, s.hits, details)
+}
+
+func (s *reportSink) Close() error {
+	return closeOutput(s.file)
+}
+
+// Standard out is left open for anything else still to write to it
+func closeOutput(file *os.File) error {
+	if file == os.Stdout {
+		return nil
+	}
+	return file.Close()
+}
+
+func NewOutputSink(format string, file *os.File, coloured bool) OutputSink {
+	if format == FormatText {
+		return &textSink{file: file, coloured: coloured}
+	}
+	return &reportSink{file: file, format: format}
+}
+
+// Takes format:path from -out, - for the path is standard out
+func ParseOutputSink(value string) (sink OutputSink, format string, path string) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		mainLogger.Fatalf("The output should be in the form format:path: %s", value)
+	}
+	format, path = parts[0], parts[1]
+	checkFormat("findings", format, findingsFormats)
+
+	if path == "-" {
+		return NewOutputSink(format, os.Stdout, true), format, path
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		mainLogger.Fatalf("Error creating the output file: %s", err)
+	}
+	return NewOutputSink(format, file, false), format, path
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sort"
+)
+
+const (
+	SortNone     = "none"
+	SortDate     = "date"
+	SortAuthor   = "author"
+	SortSeverity = "severity"
+	SortFile     = "file"
+)
+
+// Set from the command line
+var sortOrder = SortDate
+
+func checkSortOrder(order string) {
+	switch order {
+	case SortNone, SortDate, SortAuthor, SortSeverity, SortFile:
+	default:
+		mainLogger.Fatalf("Unknown sort option, expecting date, author, severity, file or none: %s", order)
+	}
+}
+
+// The commits in the order they are to be shown. Without a sort they
+// come in the order git log gave them, newest first with no parent
+// before its children, which is also what ties are broken on. Commits
+// have no severity so that leaves them in the git log order.
+func SortedCommits(order string) []Commit {
+	var commits []Commit
+	for _, id := range CommitOrder {
+		commits = append(commits, Commits[id])
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		a, b := commits[i], commits[j]
+		switch order {
+		case SortDate:
+			return a.commitDate.After(b.commitDate)
+		case SortAuthor:
+			return a.author < b.author
+		case SortFile:
+			return firstFile(a) < firstFile(b)
+		}
+		return false
+	})
+
+	return commits
+}
+
+func firstFile(commit Commit) string {
+	if len(commit.matchFiles) == 0 {
+		return ""
+	}
+	return commit.matchFiles[0].Path
+}
+
+func hitDateBefore(a Hit, b Hit) bool {
+	if a.Commit == nil || b.Commit == nil {
+		return a.Commit != nil && b.Commit == nil
+	}
+	return a.Commit.commitDate.After(b.Commit.commitDate)
+}
+
+// Hits arrive in whatever order the workers happen to finish so anything
+// the sort doesn't separate is put in order of the hit key, that way the
+// same scan always gives the same report. Dates are newest first with
+// hits which aren't tied to a commit, such as metadata, after them.
+func SortHits(hits []Hit, order string) {
+	keys := make([]string, len(hits))
+	for i := range hits {
+		keys[i] = hits[i].Key()
+	}
+
+	sort.Sort(hitSorter{hits, keys, func(a Hit, b Hit) int {
+		switch order {
+		case SortAuthor:
+			if a.Author() != b.Author() {
+				if a.Author() < b.Author() {
+					return -1
+				}
+				return 1
+			}
+		case SortSeverity:
+			if rankA, rankB := severityRanks[a.Severity], severityRanks[b.Severity]; rankA != rankB {
+				if rankA > rankB {
+					return -1
+				}
+				return 1
+			}
+		case SortFile:
+			if a.File != b.File {
+				if a.File < b.File {
+					return -1
+				}
+				return 1
+			}
+		}
+
+		// Everything falls back on the date
+		if hitDateBefore(a, b) {
+			return -1
+		}
+		if hitDateBefore(b, a) {
+			return 1
+		}
+		return 0
+	}})
+}
+
+// Keeps the keys lined up with the hits as they are moved around
+type hitSorter struct {
+	hits    []Hit
+	keys    []string
+	compare func(Hit, Hit) int
+}
+
+func (s hitSorter) Len() int {
+	return len(s.hits)
+}
+
+func (s hitSorter) Less(i, j int) bool {
+	if result := s.compare(s.hits[i], s.hits[j]); result != 0 {
+		return result < 0
+	}
+	return s.keys[i] < s.keys[j]
+}
+
+func (s hitSorter) Swap(i, j int) {
+	s.hits[i], s.hits[j] = s.hits[j], s.hits[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
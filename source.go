@@ -0,0 +1,393 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Works out where the repository to scan lives. A directory is used as
+// it is, anything else is unpacked into a scratch directory first. The
+// function returned removes anything which was created and should
+// always be called once scanning has finished. If the scan is stopped
+// while unpacking, the repository returned is empty.
+func PrepareRepository(ctx context.Context, source string) (Repository, func()) {
+	cleanup := func() {}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		mainLogger.Fatalf("The specified directory does not exist or does not contain a Git repository")
+	}
+
+	if info.IsDir() {
+		repository, err := findRepository(source, false)
+		if err != nil {
+			mainLogger.Fatal(err)
+		}
+		return repository, cleanup
+	}
+
+	scratchDir, err := os.MkdirTemp("", "githunter-")
+	if err != nil {
+		mainLogger.Fatalf("Error creating scratch directory: %s", err)
+	}
+	cleanup = func() {
+		mainLogger.Debugf("Removing scratch directory: %s", scratchDir)
+		os.RemoveAll(scratchDir)
+	}
+
+	lowerSource := strings.ToLower(source)
+	switch {
+	case strings.HasSuffix(lowerSource, ".bundle"):
+		err = unpackBundle(ctx, source, scratchDir)
+	case strings.HasSuffix(lowerSource, ".tar"):
+		err = unpackTar(source, scratchDir, false)
+	case strings.HasSuffix(lowerSource, ".tar.gz"), strings.HasSuffix(lowerSource, ".tgz"):
+		err = unpackTar(source, scratchDir, true)
+	case strings.HasSuffix(lowerSource, ".zip"):
+		err = unpackZip(source, scratchDir)
+	default:
+		cleanup()
+		mainLogger.Fatalf("Unknown file type, expecting a .bundle, .tar, .tar.gz or .zip: %s", source)
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return Repository{}, cleanup
+		}
+		cleanup()
+		mainLogger.Fatalf("Error unpacking %s: %s", source, err)
+	}
+
+	mainLogger.Debugf("Unpacked %s into %s", source, scratchDir)
+
+	repository, err := findRepository(scratchDir, true)
+	if err != nil {
+		cleanup()
+		mainLogger.Fatal(err)
+	}
+
+	// Bundles are fetched into a new repository so only archives bring
+	// their own config with them
+	if !strings.HasSuffix(lowerSource, ".bundle") {
+		if err := sanitiseRepository(repository); err != nil {
+			cleanup()
+			mainLogger.Fatalf("Error cleaning the config in %s: %s", source, err)
+		}
+	}
+
+	return repository, cleanup
+}
+
+// Archives come from someone else's machine and their configs, including
+// those of any submodules, could get git to run commands when the
+// repository is scanned, so they get the same treatment as those
+// downloaded with -url
+func sanitiseRepository(repository Repository) error {
+	return filepath.WalkDir(repository.gitDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			// Nothing but objects in there and lots of them
+			if entry.Name() == "objects" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() != "config" || !entry.Type().IsRegular() || !isGitDir(filepath.Dir(path)) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		bare := path == filepath.Join(repository.gitDir, "config") && repository.workTree == ""
+		mainLogger.Debugf("Cleaning the config in %s", path)
+		return os.WriteFile(path, sanitiseConfig(data, bare), 0644)
+	})
+}
+
+// Git directories have a HEAD file and an objects directory, which is
+// enough to tell them apart from anything else
+func isGitDir(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || info.IsDir() {
+		return false
+	}
+	if info, err := os.Stat(filepath.Join(dir, "objects")); err != nil || !info.IsDir() {
+		return false
+	}
+	return true
+}
+
+// Looks for a repository in dir, either a normal checkout with a .git
+// directory or a bare repository. Archives are often made from a level
+// or two above the repository so if search is set and neither is found,
+// the shallowest one further down is used.
+func findRepository(dir string, search bool) (Repository, error) {
+	gitDir := filepath.Join(dir, ".git")
+	mainLogger.Debugf("Checking to see if Git directory exists: %s", gitDir)
+	// A few options here, this is why I went with this one:
+	// https://goruncode.com/how-to-check-if-a-file-exists/
+	if _, err := os.Stat(gitDir); err == nil {
+		return Repository{gitDir: gitDir, workTree: dir}, nil
+	}
+
+	if isGitDir(dir) {
+		return Repository{gitDir: dir}, nil
+	}
+
+	notFound := fmt.Errorf("The specified directory does not exist or does not contain a Git repository")
+	if !search {
+		return Repository{}, notFound
+	}
+
+	found := ""
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if isGitDir(path) {
+			if found == "" || strings.Count(path, string(os.PathSeparator)) < strings.Count(found, string(os.PathSeparator)) {
+				found = path
+			}
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	if found == "" {
+		return Repository{}, notFound
+	}
+
+	if filepath.Base(found) == ".git" {
+		return Repository{gitDir: found, workTree: filepath.Dir(found)}, nil
+	}
+	return Repository{gitDir: found}, nil
+}
+
+// Fetching rather than cloning means no remote is set up pointing back
+// at the bundle, which would then show up in the metadata checks
+func unpackBundle(ctx context.Context, source string, scratchDir string) error {
+	gitDir := filepath.Join(scratchDir, "repository.git")
+
+	commands := [][]string{
+		{"init", "--quiet", "--bare", gitDir},
+		{fmt.Sprintf("--git-dir=%s", gitDir), "fetch", "--quiet", source, "+refs/*:refs/*"},
+	}
+
+	for _, cmdArgs := range commands {
+		mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+		if cmdOut, err := exec.CommandContext(ctx, "git", cmdArgs...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(cmdOut)))
+		}
+	}
+
+	return nil
+}
+
+// Stops names such as ../../etc/passwd being written outside of the
+// directory. Join cleans the target so the directory has to be cleaned as
+// well or relative ones such as ./loot would never match.
+func safeJoin(dir string, name string) (string, error) {
+	dir = filepath.Clean(dir)
+	target := filepath.Join(dir, name)
+	if target != dir && !strings.HasPrefix(target, dir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%s is outside of the target directory", name)
+	}
+	return target, nil
+}
+
+func writeFile(target string, mode os.FileMode, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, content)
+	return err
+}
+
+func unpackTar(source string, scratchDir string, compressed bool) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if compressed {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(scratchDir, header.Name)
+		if err != nil {
+			return fmt.Errorf("archive entry %w", err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, header.FileInfo().Mode().Perm(), tarReader); err != nil {
+				return err
+			}
+		default:
+			// Links could point anywhere so are not worth the risk
+			mainLogger.Debugf("Skipping archive entry: %s", header.Name)
+		}
+	}
+}
+
+func unpackZip(source string, scratchDir string) error {
+	zipReader, err := zip.OpenReader(source)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	for _, entry := range zipReader.File {
+		target, err := safeJoin(scratchDir, entry.Name)
+		if err != nil {
+			return fmt.Errorf("archive entry %w", err)
+		}
+
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !entry.Mode().IsRegular() {
+			mainLogger.Debugf("Skipping archive entry: %s", entry.Name)
+			continue
+		}
+
+		content, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, entry.Mode().Perm(), content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Strips the password out of a URL so it can be shown or handed to git
+// without giving the credentials away. Over HTTP the username goes as well
+// as the credential helper supplies both, anything else, such as ssh,
+// keeps it as it is the account to log in as.
+func redactURL(rawURL string) (string, string, string) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL, "", ""
+	}
+
+	username := parsed.User.Username()
+	password, _ := parsed.User.Password()
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		parsed.User = nil
+	} else {
+		parsed.User = url.User(username)
+		username = ""
+	}
+
+	return parsed.String(), username, password
+}
+
+// Mirror clones a repository into a scratch directory so every ref gets
+// scanned. Credentials come from GITHUNTER_USERNAME and GITHUNTER_PASSWORD,
+// or the URL, and are handed to git through a credential helper which
+// reads them from the environment so they never appear in any arguments
+// or output. Without them, git falls back to its own credential helpers.
+// As with DumpGitDirectory, stopping the scan part way through the clone
+// gives an empty repository.
+func CloneRepository(ctx context.Context, cloneURL string) (Repository, func()) {
+	safeURL, username, password := redactURL(cloneURL)
+
+	scratchDir, err := os.MkdirTemp("", "githunter-")
+	if err != nil {
+		mainLogger.Fatalf("Error creating scratch directory: %s", err)
+	}
+	cleanup := func() {
+		mainLogger.Debugf("Removing scratch directory: %s", scratchDir)
+		os.RemoveAll(scratchDir)
+	}
+
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if username != "" {
+		env = append(env, fmt.Sprintf("GITHUNTER_USERNAME=%s", username))
+	}
+	if password != "" {
+		env = append(env, fmt.Sprintf("GITHUNTER_PASSWORD=%s", password))
+	}
+
+	gitDir := filepath.Join(scratchDir, "repository.git")
+	cmdArgs := []string{}
+	if username != "" || os.Getenv("GITHUNTER_USERNAME") != "" {
+		cmdArgs = append(cmdArgs,
+			"-c", "credential.helper=",
+			"-c", `credential.helper=!f() { test "$1" = get && echo "username=${GITHUNTER_USERNAME}" && echo "password=${GITHUNTER_PASSWORD}"; }; f`,
+		)
+	}
+	cmdArgs = append(cmdArgs, "clone", "--quiet", "--mirror", safeURL, gitDir)
+
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	cmd := exec.CommandContext(ctx, "git", cmdArgs...)
+	cmd.Env = env
+	if cmdOut, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return Repository{}, cleanup
+		}
+		cleanup()
+		// Just in case git has echoed the URL back with the credentials
+		message := strings.TrimSpace(string(cmdOut))
+		if password != "" {
+			message = strings.ReplaceAll(message, password, "****")
+		}
+		mainLogger.Fatalf("Error cloning %s: %s: %s", safeURL, err, message)
+	}
+
+	// The remote only points back at what was asked for, leaving it would
+	// get it reported by the metadata checks
+	exec.Command("git", fmt.Sprintf("--git-dir=%s", gitDir), "config", "--remove-section", "remote.origin").Run()
+
+	return Repository{gitDir: gitDir}, cleanup
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	tests := []struct {
+		dir    string
+		name   string
+		want   string
+		hasErr bool
+	}{
+		{"/tmp/loot", "abc/file.txt", "/tmp/loot/abc/file.txt", false},
+		{"./loot", "abc/file.txt", "loot/abc/file.txt", false},
+		{"loot/", "file.txt", "loot/file.txt", false},
+		{"loot", ".", "loot", false},
+		{"loot", "a/../b", "loot/b", false},
+		{"/tmp/loot", "../etc/passwd", "", true},
+		{"./loot", "../../etc/passwd", "", true},
+		{"/tmp/loot", "/../../etc/passwd", "", true},
+		{"/tmp/loot", "../loot-other/file", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := safeJoin(filepath.FromSlash(test.dir), filepath.FromSlash(test.name))
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("safeJoin(%q, %q) = %q, want an error", test.dir, test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("safeJoin(%q, %q) returned an error: %s", test.dir, test.name, err)
+		} else if got != filepath.FromSlash(test.want) {
+			t.Errorf("safeJoin(%q, %q) = %q, want %q", test.dir, test.name, got, test.want)
+		}
+	}
+}
+
+func TestSanitiseRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "config", "core.fsmonitor", "touch pwned; false")
+	runGit(t, dir, "config", "remote.origin.url", "https://example.com/repo.git")
+
+	repository := Repository{gitDir: filepath.Join(dir, ".git"), workTree: dir}
+	if err := sanitiseRepository(repository); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	config, err := os.ReadFile(filepath.Join(dir, ".git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(config), "fsmonitor") {
+		t.Errorf("core.fsmonitor was not removed:\n%s", config)
+	}
+	if !strings.Contains(string(config), "https://example.com/repo.git") {
+		t.Errorf("the remote should have been kept:\n%s", config)
+	}
+	if !strings.Contains(string(config), "bare = false") {
+		t.Errorf("a repository with a work tree should not be bare:\n%s", config)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// What has been scanned in previous runs so only new commits and blobs
+// need looking at, along with everything found so far
+type ScanState struct {
+	Commits  []string `json:"commits"`
+	Blobs    []string `json:"blobs"`
+	Findings []Hit    `json:"findings"`
+
+	lock    sync.Mutex
+	commits map[string]bool
+	blobs   map[string]bool
+}
+
+// Nil unless a state file has been given
+var scanState *ScanState
+
+func LoadState(stateFile string) *ScanState {
+	state := &ScanState{}
+
+	data, err := os.ReadFile(stateFile)
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			mainLogger.Fatalf("Error parsing the state file: %s", err)
+		}
+	} else if !os.IsNotExist(err) {
+		mainLogger.Fatalf("Error reading the state file: %s", err)
+	}
+
+	state.commits = make(map[string]bool)
+	for _, id := range state.Commits {
+		state.commits[id] = true
+	}
+	state.blobs = make(map[string]bool)
+	for _, hash := range state.Blobs {
+		state.blobs[hash] = true
+	}
+
+	mainLogger.Debugf("Loaded state with %d commits, %d blobs and %d findings", len(state.commits), len(state.blobs), len(state.Findings))
+
+	return state
+}
+
+func (s *ScanState) HasCommit(id string) bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.commits[id]
+}
+
+func (s *ScanState) HasBlob(hash string) bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.blobs[hash]
+}
+
+func (s *ScanState) AddCommit(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.commits[id] = true
+}
+
+func (s *ScanState) AddBlob(hash string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.blobs[hash] = true
+}
+
+func (s *ScanState) AddFinding(hit Hit) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Findings = append(s.Findings, hit)
+}
+
+// Written to a temporary file first so a failed write doesn't lose the
+// previous state. The findings include whatever secrets were found so
+// the file is only readable by the owner.
+func (s *ScanState) Save(stateFile string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Commits = []string{}
+	for id := range s.commits {
+		s.Commits = append(s.Commits, id)
+	}
+	sort.Strings(s.Commits)
+
+	s.Blobs = []string{}
+	for hash := range s.blobs {
+		s.Blobs = append(s.Blobs, hash)
+	}
+	sort.Strings(s.Blobs)
+
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(stateFile), ".githunter-state-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), stateFile)
+}
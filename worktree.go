@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	core "github.com/digininja/GitHunter/gitrob"
+)
+
+type WorktreeFile struct {
+	path  string
+	state string
+}
+
+// The repository's config belongs to whoever made it and git status can
+// be told to run commands through it, to watch the files, to clean them
+// before comparing them or from hooks when the index is updated. These
+// switch all of that off. Filter drivers can have any name so the ones
+// which have been set up are looked for and blanked out.
+func safeStatusArgs(ctx context.Context, repository Repository) []string {
+	args := []string{
+		"-c", "core.fsmonitor=false",
+		"-c", "core.hooksPath=" + os.DevNull,
+	}
+
+	cmdArgs := []string{fmt.Sprintf("--git-dir=%s", repository.gitDir), "config", "--get-regexp", `^filter\.`}
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	// Fails if there are no filters, which is the usual case
+	cmdOut, _ := exec.CommandContext(ctx, "git", cmdArgs...).Output()
+	drivers := make(map[string]bool)
+	for _, line := range strings.Split(string(cmdOut), "\n") {
+		key, _, _ := strings.Cut(line, " ")
+		if !strings.HasPrefix(key, "filter.") {
+			continue
+		}
+		driver := strings.TrimPrefix(key[:strings.LastIndex(key, ".")], "filter.")
+		if drivers[driver] {
+			continue
+		}
+		drivers[driver] = true
+		for _, command := range []string{"clean", "smudge", "process"} {
+			args = append(args, "-c", fmt.Sprintf("filter.%s.%s=", driver, command))
+		}
+	}
+
+	return args
+}
+
+// Asks git for everything in the working directory which differs from
+// what is committed, including files it has been told to ignore as
+// that is where people tend to hide their .env files.
+func GetWorktreeFiles(ctx context.Context, repository Repository) []WorktreeFile {
+	var (
+		cmdOut []byte
+		err    error
+	)
+
+	cmdName := "git"
+	cmdArgs := []string{
+		fmt.Sprintf("--git-dir=%s", repository.gitDir),
+		fmt.Sprintf("--work-tree=%s", repository.workTree),
+	}
+	cmdArgs = append(cmdArgs, safeStatusArgs(ctx, repository)...)
+	// Not writing the index back means nothing is triggered by it changing
+	cmdArgs = append(cmdArgs, "--no-optional-locks", "status", "--porcelain", "-z", "--ignored=traditional", "--untracked-files=all")
+
+	mainLogger.Debug("Getting the working tree status")
+	mainLogger.Debugf("Command arguments are: %s", cmdArgs)
+
+	if cmdOut, err = exec.CommandContext(ctx, cmdName, cmdArgs...).Output(); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		mainLogger.Fatal(fmt.Sprintf("There was an error running git status command: %s", err))
+	}
+
+	var files []WorktreeFile
+
+	// Entries are "XY path" separated by NULs, renames and copies
+	// are followed by an extra entry with the original path
+	entries := bytes.Split(cmdOut, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		entry := string(entries[i])
+		if len(entry) < 4 {
+			continue
+		}
+		status := entry[0:2]
+		path := entry[3:]
+
+		if status[0] == 'R' || status[0] == 'C' {
+			i++
+		}
+
+		state := ""
+		switch {
+		case status == "??":
+			state = "untracked"
+		case status == "!!":
+			state = "ignored"
+		case status[0] == 'D' || status[1] == 'D':
+			// Nothing left on disk to look at
+			continue
+		default:
+			state = "modified"
+		}
+
+		files = append(files, WorktreeFile{path, state})
+	}
+
+	return files
+}
+
+func WorktreeSearch(ctx context.Context, repository Repository) {
+	for _, file := range GetWorktreeFiles(ctx, repository) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		fullPath := filepath.Join(repository.workTree, file.path)
+		info, err := os.Stat(fullPath)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		matchFile := core.NewMatchFile(file.path)
+		for _, signature := range core.Signatures {
+			if signature.Match(matchFile) {
+				hit := Hit{
+					Type:        UncommittedFileMatch,
+					Description: signature.Description(),
+					Comment:     signature.Comment(),
+					Submodule:   repository.submodule,
+					File:        file.path,
+				}
+				hit.AddField("State", file.state)
+
+				mainLogger.Debugf("Adding WorktreeSearch file result for %s to channel", file.path)
+				hitsChannel <- hit
+			}
+		}
+
+		// Ignored files include build output and the likes of node_modules
+		data, err := ReadSearchableFile(fullPath)
+		if err != nil {
+			mainLogger.Debugf("Could not read %s: %s", fullPath, err)
+			continue
+		}
+
+		for _, match := range SearchContent(data) {
+			hit := Hit{
+				Type:        UncommittedGrepMatch,
+				Severity:    match.signature.GetSeverity(),
+				Description: match.signature.GetDescription(),
+				Submodule:   repository.submodule,
+				File:        file.path,
+				Line:        match.line,
+				LineNumber:  match.lineNumber,
+				Context:     match.context,
+			}
+			hit.AddField("State", file.state)
+
+			mainLogger.Debugf("Adding WorktreeSearch content result for %s to channel", file.path)
+			hitsChannel <- hit
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetWorktreeFilesHostileConfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "pwned")
+	command := "touch " + marker + "; false"
+
+	runGit(t, dir, "init", "--quiet")
+	if err := os.WriteFile(filepath.Join(dir, ".gitattributes"), []byte("*.txt filter=evil\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "one")
+
+	runGit(t, dir, "config", "core.fsmonitor", command)
+	runGit(t, dir, "config", "filter.evil.clean", command)
+	runGit(t, dir, "config", "filter.evil.process", command)
+	hook := filepath.Join(dir, ".git", "hooks", "post-index-change")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\n"+command+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repository := Repository{gitDir: filepath.Join(dir, ".git"), workTree: dir}
+	files := GetWorktreeFiles(context.Background(), repository)
+
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("the repository's config was able to run a command")
+	}
+
+	found := false
+	for _, file := range files {
+		if file.path == "file.txt" && file.state == "modified" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("file.txt should have been listed as modified, got %v", files)
+	}
+}